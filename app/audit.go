@@ -0,0 +1,70 @@
+package app
+
+import (
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+	"time"
+)
+
+const (
+	// createdAtField is the field holding the creation time of the
+	// elements, in audited resources.
+	createdAtField = "created_at"
+
+	// createdByField is the field holding the id of the API key that
+	// created the elements, in audited resources.
+	createdByField = "created_by"
+
+	// updatedAtField is the field holding the time of the last write
+	// of the elements, in audited resources.
+	updatedAtField = "updated_at"
+
+	// updatedByField is the field holding the id of the API key that
+	// last wrote the elements, in audited resources.
+	updatedByField = "updated_by"
+)
+
+// auditFields are the fields maintained in audited resources. They
+// cannot be set by the clients.
+var auditFields = []string{createdAtField, createdByField, updatedAtField, updatedByField}
+
+// actorOf returns the id of the API key performing a request, or the
+// nil id if the request was not authenticated.
+func actorOf(ctx echo.Context) primitive.ObjectID {
+	if token := authToken(ctx); token != nil {
+		return token.ID
+	}
+	return primitive.NilObjectID
+}
+
+// auditFieldsOf returns the update (and, when creating, also the
+// creation) fields to store on a write.
+func auditFieldsOf(ctx echo.Context, at time.Time, creating bool) []bson.E {
+	actor := actorOf(ctx)
+	fields := []bson.E{{Key: updatedAtField, Value: at}, {Key: updatedByField, Value: actor}}
+	if creating {
+		fields = append(fields, bson.E{Key: createdAtField, Value: at}, bson.E{Key: createdByField, Value: actor})
+	}
+	return fields
+}
+
+// fieldsOf returns some of the fields of a stored document, when
+// present.
+func fieldsOf(raw bson.Raw, keys ...string) []bson.E {
+	fields := []bson.E{}
+	for _, key := range keys {
+		if value, err := raw.LookupErr(key); err == nil {
+			fields = append(fields, bson.E{Key: key, Value: value})
+		}
+	}
+	return fields
+}
+
+// withoutFields removes the given fields from a document.
+func withoutFields(document bson.D, keys ...string) bson.D {
+	return slices.DeleteFunc(document, func(element bson.E) bool {
+		return slices.Contains(keys, element.Key)
+	})
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAuditFieldsOf(t *testing.T) {
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	actor := primitive.NewObjectID()
+	cases := []struct {
+		name     string
+		token    *auth.AuthToken
+		creating bool
+		expected []bson.E
+	}{
+		{
+			"tells the update fields", &auth.AuthToken{ID: actor}, false,
+			[]bson.E{{Key: updatedAtField, Value: at}, {Key: updatedByField, Value: actor}},
+		},
+		{
+			"tells the creation fields", &auth.AuthToken{ID: actor}, true,
+			[]bson.E{
+				{Key: updatedAtField, Value: at}, {Key: updatedByField, Value: actor},
+				{Key: createdAtField, Value: at}, {Key: createdByField, Value: actor},
+			},
+		},
+		{
+			"tells the nil actor when not authenticated", nil, false,
+			[]bson.E{{Key: updatedAtField, Value: at}, {Key: updatedByField, Value: primitive.NilObjectID}},
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			ctx, _ := newTestContext(http.MethodPost, "/", nil)
+			if case_.token != nil {
+				ctx.Set(authTokenKey, case_.token)
+			}
+			if fields := auditFieldsOf(ctx, at, case_.creating); !reflect.DeepEqual(fields, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, fields)
+			}
+		})
+	}
+}
+
+func TestAuditedDocument(t *testing.T) {
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	content := bson.D{
+		{Key: "a", Value: "x"}, {Key: createdByField, Value: "forged"}, {Key: updatedAtField, Value: "forged"},
+	}
+	cases := []struct {
+		name     string
+		tracking Tracking
+		creating bool
+		expected bson.D
+	}{
+		{
+			"keeps the content when not audited", Tracking{}, true,
+			append(content, bson.E{Key: modifiedAtField, Value: at}),
+		},
+		{
+			"discards the client-provided audit fields", Tracking{Audited: true}, false,
+			bson.D{
+				{Key: "a", Value: "x"}, {Key: modifiedAtField, Value: at},
+				{Key: updatedAtField, Value: at}, {Key: updatedByField, Value: primitive.NilObjectID},
+			},
+		},
+		{
+			"sets the creation fields", Tracking{Audited: true}, true,
+			bson.D{
+				{Key: "a", Value: "x"}, {Key: modifiedAtField, Value: at},
+				{Key: updatedAtField, Value: at}, {Key: updatedByField, Value: primitive.NilObjectID},
+				{Key: createdAtField, Value: at}, {Key: createdByField, Value: primitive.NilObjectID},
+			},
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			ctx, _ := newTestContext(http.MethodPost, "/", nil)
+			document, err := case_.tracking.document(ctx, content, ElementMeta{ModifiedAt: at}, case_.creating)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(document, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, document)
+			}
+		})
+	}
+}
+
+func TestFieldsOf(t *testing.T) {
+	raw, _ := bson.Marshal(bson.D{{Key: "a", Value: "x"}, {Key: "b", Value: "y"}})
+	fields := fieldsOf(raw, "b", "c")
+	if len(fields) != 1 || fields[0].Key != "b" || fields[0].Value.(bson.RawValue).StringValue() != "y" {
+		t.Fatalf("expected only the field b, got %v", fields)
+	}
+}
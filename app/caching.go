@@ -0,0 +1,135 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheEntry is an element kept in an element cache.
+type cacheEntry struct {
+	element any
+	meta    ElementMeta
+	expires time.Time
+}
+
+// elementCache is an in-memory cache of the elements read from
+// a resource, keyed by the id and the retrieved fields. Any write
+// increments the generation of the cache and clears it, so the
+// reads that started before it are not cached.
+type elementCache struct {
+	mutex      sync.Mutex
+	ttl        time.Duration
+	generation uint64
+	entries    map[string]cacheEntry
+}
+
+// cacheKey builds the key of an element in an element cache.
+func cacheKey(id primitive.ObjectID, fields []string) string {
+	return id.Hex() + ":" + strings.Join(fields, ",")
+}
+
+// get returns a cached element, if present and not expired. It also
+// returns the current generation of the cache.
+func (cache *elementCache) get(key string) (cacheEntry, uint64, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	entry, ok := cache.entries[key]
+	if ok && time.Now().After(entry.expires) {
+		delete(cache.entries, key)
+		ok = false
+	}
+	return entry, cache.generation, ok
+}
+
+// put caches an element, unless the cache was invalidated since the
+// given generation. The expired elements are removed meanwhile.
+func (cache *elementCache) put(key string, generation uint64, element any, meta ElementMeta) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if generation != cache.generation {
+		return
+	}
+	now := time.Now()
+	for key, entry := range cache.entries {
+		if now.After(entry.expires) {
+			delete(cache.entries, key)
+		}
+	}
+	cache.entries[key] = cacheEntry{element: element, meta: meta, expires: now.Add(cache.ttl)}
+}
+
+// invalidate clears the cache.
+func (cache *elementCache) invalidate() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.generation++
+	clear(cache.entries)
+}
+
+// makeCachedGetOne wraps a function that gets one element so the
+// retrieved elements are cached for some time. It also returns the
+// function that invalidates the cache, which must be invoked on any
+// write. Only the found elements are cached, and the cached ones are
+// shared among requests (so they must not be modified).
+func makeCachedGetOne(getOne GetOneFunc, ttl time.Duration) (GetOneFunc, func()) {
+	cache := &elementCache{ttl: ttl, entries: map[string]cacheEntry{}}
+	return func(ctx echo.Context, id primitive.ObjectID, fields ...string) (any, ElementMeta, error) {
+		key := cacheKey(id, fields)
+		entry, generation, ok := cache.get(key)
+		if ok {
+			return entry.element, entry.meta, nil
+		}
+		element, meta, err := getOne(ctx, id, fields...)
+		if err == nil {
+			cache.put(key, generation, element, meta)
+		}
+		return element, meta, err
+	}, cache.invalidate
+}
+
+// elementETag computes the entity tag of an element: its version,
+// in versioned resources, or a hash of its JSON representation
+// otherwise.
+func elementETag(element any, meta ElementMeta) (string, error) {
+	if meta.Versioned || meta.Version > 0 {
+		return etag(meta.Version), nil
+	}
+	if content, err := json.Marshal(element); err != nil {
+		return "", err
+	} else {
+		sum := sha256.Sum256(content)
+		return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+	}
+}
+
+// matchesETag tells whether an If-None-Match header matches an entity
+// tag (using the weak comparison).
+func matchesETag(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified tells whether the client already has the current
+// representation of an element, according to the If-None-Match
+// or (only when absent) the If-Modified-Since headers.
+func notModified(ctx echo.Context, tag string, meta ElementMeta) bool {
+	if header := strings.TrimSpace(ctx.Request().Header.Get("If-None-Match")); header != "" {
+		return matchesETag(header, tag)
+	} else if header := ctx.Request().Header.Get("If-Modified-Since"); header != "" && !meta.ModifiedAt.IsZero() {
+		since, err := http.ParseTime(header)
+		return err == nil && !meta.ModifiedAt.Truncate(time.Second).After(since)
+	}
+	return false
+}
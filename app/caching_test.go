@@ -0,0 +1,159 @@
+package app
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestElementETag(t *testing.T) {
+	hashed, _ := elementETag(echo.Map{"a": 1}, ElementMeta{})
+	cases := []struct {
+		name     string
+		element  any
+		meta     ElementMeta
+		expected string
+	}{
+		{"tells the version", echo.Map{"a": 1}, ElementMeta{Version: 3}, `"3"`},
+		{"tells the version 0 when versioned", echo.Map{"a": 1}, ElementMeta{Versioned: true}, `"0"`},
+		{"hashes equal contents alike", echo.Map{"a": 1}, ElementMeta{}, hashed},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if tag, err := elementETag(case_.element, case_.meta); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if tag != case_.expected {
+				t.Fatalf("expected %s, got %s", case_.expected, tag)
+			}
+		})
+	}
+
+	if other, _ := elementETag(echo.Map{"a": 2}, ElementMeta{}); other == hashed {
+		t.Fatalf("expected different contents to have different tags, got %s", other)
+	} else if len(hashed) != 34 {
+		t.Fatalf("expected a quoted 32-digit hash, got %s", hashed)
+	}
+}
+
+func TestMatchesETag(t *testing.T) {
+	cases := []struct {
+		name     string
+		header   string
+		expected bool
+	}{
+		{"matches the tag", `"1"`, true},
+		{"matches any tag", "*", true},
+		{"matches among many tags", `"2", "1"`, true},
+		{"matches weak tags", `W/"1"`, true},
+		{"does not match other tags", `"2", W/"3"`, false},
+		{"does not match unquoted tags", "1", false},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if matches := matchesETag(case_.header, `"1"`); matches != case_.expected {
+				t.Fatalf("expected %v, got %v", case_.expected, matches)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	modifiedAt := time.Date(2020, 1, 1, 12, 0, 0, 500000000, time.UTC)
+	cases := []struct {
+		name       string
+		header     map[string]string
+		modifiedAt time.Time
+		expected   bool
+	}{
+		{"tells modified without headers", nil, modifiedAt, false},
+		{"tells not modified for the tag", map[string]string{"If-None-Match": `"1"`}, modifiedAt, true},
+		{"tells modified for other tags", map[string]string{"If-None-Match": `"2"`}, modifiedAt, false},
+		{
+			"prefers the tag over the time",
+			map[string]string{"If-None-Match": `"2"`, "If-Modified-Since": "Wed, 01 Jan 2020 12:00:00 GMT"},
+			modifiedAt, false,
+		},
+		{
+			"tells not modified since the same second",
+			map[string]string{"If-Modified-Since": "Wed, 01 Jan 2020 12:00:00 GMT"}, modifiedAt, true,
+		},
+		{
+			"tells modified since earlier times",
+			map[string]string{"If-Modified-Since": "Wed, 01 Jan 2020 11:59:59 GMT"}, modifiedAt, false,
+		},
+		{
+			"tells modified without a modification time",
+			map[string]string{"If-Modified-Since": "Wed, 01 Jan 2020 12:00:00 GMT"}, time.Time{}, false,
+		},
+		{"tells modified for invalid times", map[string]string{"If-Modified-Since": "x"}, modifiedAt, false},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			ctx, _ := newTestContext(http.MethodGet, "/", case_.header)
+			if result := notModified(ctx, `"1"`, ElementMeta{ModifiedAt: case_.modifiedAt}); result != case_.expected {
+				t.Fatalf("expected %v, got %v", case_.expected, result)
+			}
+		})
+	}
+}
+
+func TestOkWithElementNotModified(t *testing.T) {
+	ctx, recorder := newTestContext(http.MethodGet, "/", map[string]string{"If-None-Match": `"2"`})
+	if err := okWithElement(ctx, echo.Map{"a": 1}, ElementMeta{Version: 2}, slog.Default()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if recorder.Code != http.StatusNotModified {
+		t.Fatalf("expected status 304, got %d", recorder.Code)
+	} else if tag := recorder.Header().Get("ETag"); tag != `"2"` {
+		t.Fatalf("expected the tag \"2\", got %s", tag)
+	}
+}
+
+func TestCachedGetOne(t *testing.T) {
+	calls := 0
+	getOne := func(ctx echo.Context, id primitive.ObjectID, fields ...string) (any, ElementMeta, error) {
+		calls++
+		if id.IsZero() {
+			return nil, ElementMeta{}, errors.New("not found")
+		}
+		return calls, ElementMeta{}, nil
+	}
+	cached, invalidate := makeCachedGetOne(getOne, time.Minute)
+	ctx, _ := newTestContext(http.MethodGet, "/", nil)
+	id := primitive.NewObjectID()
+
+	cases := []struct {
+		name     string
+		id       primitive.ObjectID
+		fields   []string
+		before   func()
+		expected any
+	}{
+		{"gets uncached elements", id, nil, nil, 1},
+		{"gets cached elements", id, nil, nil, 1},
+		{"caches other fields apart", id, []string{"a"}, nil, 2},
+		{"does not cache errors", primitive.NilObjectID, nil, nil, nil},
+		{"does not cache after errors", primitive.NilObjectID, nil, nil, nil},
+		{"gets elements again after invalidating", id, nil, invalidate, 5},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if case_.before != nil {
+				case_.before()
+			}
+			if element, _, _ := cached(ctx, case_.id, case_.fields...); element != case_.expected {
+				t.Fatalf("expected %v, got %v", case_.expected, element)
+			}
+		})
+	}
+	if calls != 5 {
+		t.Fatalf("expected 5 calls, got %d", calls)
+	}
+}
@@ -34,7 +34,19 @@ func checkId(ctx echo.Context, arg string, raiseNotFoundOnError bool) (primitive
 	}
 }
 
+// authTokenKey is the key of the context value holding the token
+// of an authenticated request.
+const authTokenKey = "auth-token"
+
+// authToken returns the token of an authenticated request, or nil
+// if the request was not authenticated.
+func authToken(ctx echo.Context) *auth.AuthToken {
+	token, _ := ctx.Get(authTokenKey).(*auth.AuthToken)
+	return token
+}
+
 // authenticate performs an authentication and permissions check.
+// On success, the token is kept in the context.
 func authenticate(ctx echo.Context, collection *mongo.Collection, key, permission string) (bool, error) {
 	token := ctx.Request().Header.Get("Authorization")
 	if token == "" {
@@ -73,5 +85,6 @@ func authenticate(ctx echo.Context, collection *mongo.Collection, key, permissio
 		return false, responses.AuthForbidden(ctx)
 	}
 
+	ctx.Set(authTokenKey, &tokenRecord)
 	return true, nil
 }
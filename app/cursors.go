@@ -0,0 +1,174 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+)
+
+// errInvalidCursor is returned when a pagination cursor is malformed,
+// tampered, or was issued for a different resource or sort criteria.
+var errInvalidCursor = errors.New("invalid cursor")
+
+// errCursorNotSupported is returned when cursor-based pagination is
+// requested for a sort criteria that cannot be used with cursors
+// (e.g. sorting by relevance in a full-text search).
+var errCursorNotSupported = errors.New("cursor not supported")
+
+// CursorEncoderFunc is a function that encodes the sort key values
+// of the last seen element, for the given sort, into a signed token.
+type CursorEncoderFunc func(bson.D, []bson.RawValue) (string, error)
+
+// CursorDecoderFunc is a function that decodes a signed token back
+// into the sort key values of the last seen element, ensuring the
+// token was issued for the given sort.
+type CursorDecoderFunc func(bson.D, string) ([]bson.RawValue, error)
+
+// cursorPayload is the content of a pagination cursor.
+type cursorPayload struct {
+	Sort   string          `bson:"s"`
+	Values []bson.RawValue `bson:"v"`
+}
+
+// sortDirection tells the direction of a sort entry: -1 when the value
+// is a negative number, or 1 otherwise.
+func sortDirection(value any) int {
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return -1
+		}
+	case int32:
+		if v < 0 {
+			return -1
+		}
+	case int64:
+		if v < 0 {
+			return -1
+		}
+	case float64:
+		if v < 0 {
+			return -1
+		}
+	}
+	return 1
+}
+
+// sortSpec renders a sort criteria as a string (e.g. "score:-1,_id:1").
+func sortSpec(sort bson.D) string {
+	parts := make([]string, len(sort))
+	for index, element := range sort {
+		parts[index] = fmt.Sprintf("%s:%d", element.Key, sortDirection(element.Value))
+	}
+	return strings.Join(parts, ",")
+}
+
+// makeCursorCodec makes the functions that encode and decode pagination
+// cursors. Cursors are signed with the given secret and are only valid
+// for the given scope (typically, the resource key).
+func makeCursorCodec(secret []byte, scope string) (CursorEncoderFunc, CursorDecoderFunc) {
+	sign := func(payload []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(scope))
+		mac.Write([]byte{0})
+		mac.Write(payload)
+		return mac.Sum(nil)
+	}
+	encoding := base64.RawURLEncoding
+
+	return func(sort bson.D, values []bson.RawValue) (string, error) {
+			if payload, err := bson.Marshal(cursorPayload{Sort: sortSpec(sort), Values: values}); err != nil {
+				return "", err
+			} else {
+				return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(sign(payload)), nil
+			}
+		}, func(sort bson.D, token string) ([]bson.RawValue, error) {
+			parts := strings.Split(token, ".")
+			if len(parts) != 2 {
+				return nil, errInvalidCursor
+			}
+			payload, err := encoding.DecodeString(parts[0])
+			if err != nil {
+				return nil, errInvalidCursor
+			}
+			signature, err := encoding.DecodeString(parts[1])
+			if err != nil || !hmac.Equal(signature, sign(payload)) {
+				return nil, errInvalidCursor
+			}
+			var decoded cursorPayload
+			if err := bson.Unmarshal(payload, &decoded); err != nil {
+				return nil, errInvalidCursor
+			}
+			if decoded.Sort != sortSpec(sort) || len(decoded.Values) != len(sort) {
+				return nil, errInvalidCursor
+			}
+			return decoded.Values, nil
+		}
+}
+
+// isCursorSortable tells whether a sort criteria can be used with
+// cursor-based pagination (i.e. it only involves actual fields).
+func isCursorSortable(sort bson.D) bool {
+	for _, element := range sort {
+		switch element.Value.(type) {
+		case int, int32, int64, float64:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// cursorFilter builds the filter that matches the elements that come
+// after the last seen one (whose sort key values are given) for the
+// given sort criteria. Null and missing values sort before any other
+// value but are not reached by the $gt / $lt operators, so they are
+// matched explicitly.
+func cursorFilter(sort bson.D, values []bson.RawValue) bson.M {
+	alternatives := bson.A{}
+	for index, element := range sort {
+		alternative := bson.M{}
+		for previous := 0; previous < index; previous++ {
+			alternative[sort[previous].Key] = values[previous]
+		}
+		null := values[index].Type == bson.TypeNull || values[index].Type == bson.TypeUndefined
+		if sortDirection(element.Value) > 0 {
+			if null {
+				alternative[element.Key] = bson.M{"$ne": nil}
+			} else {
+				alternative[element.Key] = bson.M{"$gt": values[index]}
+			}
+		} else if null {
+			// Nothing comes after a null value in descending order.
+			continue
+		} else {
+			alternative["$or"] = bson.A{
+				bson.M{element.Key: bson.M{"$lt": values[index]}},
+				bson.M{element.Key: nil},
+			}
+		}
+		alternatives = append(alternatives, alternative)
+	}
+	if len(alternatives) == 0 {
+		return bson.M{"_id": bson.M{"$in": bson.A{}}}
+	}
+	return bson.M{"$or": alternatives}
+}
+
+// cursorValues extracts the sort key values from a raw document.
+// Missing fields are taken as null.
+func cursorValues(sort bson.D, document bson.Raw) []bson.RawValue {
+	values := make([]bson.RawValue, len(sort))
+	for index, element := range sort {
+		if value, err := document.LookupErr(strings.Split(element.Key, ".")...); err != nil {
+			values[index] = bson.RawValue{Type: bson.TypeNull}
+		} else {
+			values[index] = value
+		}
+	}
+	return values
+}
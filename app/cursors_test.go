@@ -0,0 +1,160 @@
+package app
+
+import (
+	"encoding/base64"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// rawValue converts a value into a raw BSON value.
+func rawValue(t *testing.T, value any) bson.RawValue {
+	t.Helper()
+	type_, data, err := bson.MarshalValue(value)
+	if err != nil {
+		t.Fatalf("cannot marshal %v: %v", value, err)
+	}
+	return bson.RawValue{Type: type_, Value: data}
+}
+
+func TestCursorCodec(t *testing.T) {
+	encode, decode := makeCursorCodec([]byte("secret"), "items")
+	sort := bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}
+	values := []bson.RawValue{rawValue(t, 3.5), rawValue(t, "x")}
+	token, err := encode(sort, values)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	payload, signature, _ := strings.Cut(token, ".")
+	tampered, _ := base64.RawURLEncoding.DecodeString(payload)
+	tampered[len(tampered)-2] ^= 1
+	_, otherScope := makeCursorCodec([]byte("secret"), "others")
+	_, otherSecret := makeCursorCodec([]byte("other"), "items")
+
+	if decoded, err := decode(sort, token); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !reflect.DeepEqual(decoded, values) {
+		t.Fatalf("expected %v, got %v", values, decoded)
+	}
+
+	cases := []struct {
+		name   string
+		decode CursorDecoderFunc
+		sort   bson.D
+		token  string
+	}{
+		{"rejects malformed tokens", decode, sort, "x"},
+		{"rejects tokens with more parts", decode, sort, token + ".x"},
+		{"rejects invalid encodings", decode, sort, "!." + signature},
+		{
+			"rejects tampered payloads", decode, sort,
+			base64.RawURLEncoding.EncodeToString(tampered) + "." + signature,
+		},
+		{"rejects tampered signatures", decode, sort, payload + "." + signature[1:]},
+		{"rejects other scopes", otherScope, sort, token},
+		{"rejects other secrets", otherSecret, sort, token},
+		{"rejects other sort directions", decode, bson.D{{Key: "score", Value: 1}, {Key: "_id", Value: 1}}, token},
+		{"rejects other sort fields", decode, bson.D{{Key: "name", Value: -1}, {Key: "_id", Value: 1}}, token},
+		{"rejects shorter sorts", decode, bson.D{{Key: "score", Value: -1}}, token},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if values, err := case_.decode(case_.sort, case_.token); !errors.Is(err, errInvalidCursor) {
+				t.Fatalf("expected an invalid cursor, got %v, %v", values, err)
+			}
+		})
+	}
+}
+
+func TestIsCursorSortable(t *testing.T) {
+	if !isCursorSortable(bson.D{{Key: "a", Value: 1}, {Key: "b", Value: int64(-1)}}) {
+		t.Fatalf("expected field sorts to be cursor-sortable")
+	}
+	if isCursorSortable(bson.D{textScoreSort}) {
+		t.Fatalf("expected relevance sorts not to be cursor-sortable")
+	}
+}
+
+func TestWithTiebreaker(t *testing.T) {
+	sort := bson.D{{Key: "a", Value: -1}}
+	expected := bson.D{{Key: "a", Value: -1}, {Key: "_id", Value: 1}}
+	if !reflect.DeepEqual(withTiebreaker(sort), expected) {
+		t.Fatalf("expected %v, got %v", expected, withTiebreaker(sort))
+	} else if len(sort) != 1 {
+		t.Fatalf("the original sort was changed: %v", sort)
+	}
+	sort = bson.D{{Key: "_id", Value: -1}, {Key: "a", Value: 1}}
+	if !reflect.DeepEqual(withTiebreaker(sort), sort) {
+		t.Fatalf("expected %v, got %v", sort, withTiebreaker(sort))
+	}
+}
+
+func TestCursorFilter(t *testing.T) {
+	null := bson.RawValue{Type: bson.TypeNull}
+	a, id := rawValue(t, 5), rawValue(t, "x")
+	cases := []struct {
+		name     string
+		sort     bson.D
+		values   []bson.RawValue
+		expected bson.M
+	}{
+		{
+			"follows ascending values", bson.D{{Key: "a", Value: 1}, {Key: "_id", Value: 1}}, []bson.RawValue{a, id},
+			bson.M{"$or": bson.A{
+				bson.M{"a": bson.M{"$gt": a}},
+				bson.M{"a": a, "_id": bson.M{"$gt": id}},
+			}},
+		},
+		{
+			"reaches nulls after descending values", bson.D{{Key: "a", Value: -1}, {Key: "_id", Value: 1}},
+			[]bson.RawValue{a, id},
+			bson.M{"$or": bson.A{
+				bson.M{"$or": bson.A{bson.M{"a": bson.M{"$lt": a}}, bson.M{"a": nil}}},
+				bson.M{"a": a, "_id": bson.M{"$gt": id}},
+			}},
+		},
+		{
+			"follows ascending nulls with any value", bson.D{{Key: "a", Value: 1}, {Key: "_id", Value: 1}},
+			[]bson.RawValue{null, id},
+			bson.M{"$or": bson.A{
+				bson.M{"a": bson.M{"$ne": nil}},
+				bson.M{"a": null, "_id": bson.M{"$gt": id}},
+			}},
+		},
+		{
+			"follows descending nulls only by the tiebreaker", bson.D{{Key: "a", Value: -1}, {Key: "_id", Value: 1}},
+			[]bson.RawValue{null, id},
+			bson.M{"$or": bson.A{
+				bson.M{"a": null, "_id": bson.M{"$gt": id}},
+			}},
+		},
+		{
+			"matches nothing after the last null", bson.D{{Key: "a", Value: -1}}, []bson.RawValue{null},
+			bson.M{"_id": bson.M{"$in": bson.A{}}},
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if filter := cursorFilter(case_.sort, case_.values); !reflect.DeepEqual(filter, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, filter)
+			}
+		})
+	}
+}
+
+func TestCursorValues(t *testing.T) {
+	document, _ := bson.Marshal(bson.M{"a": bson.M{"b": 5}, "_id": "x"})
+	sort := bson.D{{Key: "a.b", Value: 1}, {Key: "c", Value: 1}, {Key: "_id", Value: 1}}
+	values := cursorValues(sort, document)
+	if b, ok := values[0].AsInt64OK(); !ok || b != 5 {
+		t.Fatalf("expected a.b to be 5, got %v", values[0])
+	} else if values[1].Type != bson.TypeNull {
+		t.Fatalf("expected c to be null, got %v", values[1])
+	} else if id, ok := values[2].StringValueOK(); !ok || id != "x" {
+		t.Fatalf("expected _id to be x, got %v", values[2])
+	}
+}
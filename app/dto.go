@@ -0,0 +1,97 @@
+package app
+
+import (
+	"errors"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/responses"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"log/slog"
+	"reflect"
+)
+
+// InputFunc stands for a function that converts a client-provided
+// element (of the input type) into an element of the model type.
+type InputFunc func(any) (any, error)
+
+// makeInput makes the function that instantiates the elements bound
+// from the request bodies and the function that converts them to the
+// model type. When the resource has no input type, the elements are
+// bound to the model type, and there is nothing to convert (nil).
+func makeInput(resource *dsl.Resource, make_ func() any) (func() any, InputFunc) {
+	if resource.InputType == nil {
+		return make_, nil
+	}
+
+	inputType := reflect.TypeOf(resource.InputType())
+	if inputType.Kind() != reflect.Struct {
+		panic("the input type is not a struct: " + inputType.Name())
+	}
+	fromInput := resource.FromInput
+	makeBody := func() any { return reflect.New(inputType).Interface() }
+	return makeBody, func(input any) (any, error) {
+		element := make_()
+		if err := fromInput(input, element); err != nil {
+			return nil, err
+		}
+		return element, nil
+	}
+}
+
+// makeInputFields returns the types of the fields of the input type,
+// keyed by the names they are mapped to in BSON, or nil when the
+// resource has no input type.
+func makeInputFields(resource *dsl.Resource) map[string]reflect.Type {
+	if resource.InputType == nil {
+		return nil
+	}
+	return makeModelFields(resource.InputType())
+}
+
+// convertInput converts an element to the model type, if there is an
+// input type.
+func convertInput(input InputFunc, element any) (any, error) {
+	if input == nil {
+		return element, nil
+	}
+	return input(element)
+}
+
+// readInput reads and validates an element from the request body and,
+// if there is an input type, converts it to the model type.
+func readInput(
+	ctx echo.Context, makeBody func() any, input InputFunc, validator_ *validator.Validate, logger *slog.Logger,
+) (any, bool, error) {
+	if parsed, ok, err := readJSONBody(ctx, makeBody, validator_); !ok {
+		return nil, false, err
+	} else if element, err := convertInput(input, parsed); err != nil {
+		return nil, false, inputError(ctx, err, logger)
+	} else {
+		return element, true, nil
+	}
+}
+
+// inputError renders the failure to convert an element from the input
+// type. A *responses.Error is rendered as it is, while any other error
+// is rendered as an internal error.
+func inputError(ctx echo.Context, err error, logger *slog.Logger) error {
+	var abort *responses.Error
+	if errors.As(err, &abort) {
+		return abort.Render(ctx)
+	}
+	logger.Error("An error occurred: " + err.Error())
+	return responses.InternalError(ctx)
+}
+
+// errorElement builds the message of a failure on a single element
+// (e.g. converting it from the input type, or running a hook on it).
+// A *responses.Error is rendered as its element, while any other
+// error is rendered as an internal error.
+func errorElement(err error, logger *slog.Logger) echo.Map {
+	var abort *responses.Error
+	if errors.As(err, &abort) {
+		return abort.Element()
+	}
+	logger.Error("An error occurred: " + err.Error())
+	return responses.InternalErrorElement()
+}
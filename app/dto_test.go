@@ -0,0 +1,142 @@
+package app
+
+import (
+	"errors"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/responses"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dtoInput is the input type used to test the DTOs.
+type dtoInput struct {
+	FullName string `json:"full_name" validate:"required"`
+}
+
+// dtoOutput is the output type used to test the DTOs.
+type dtoOutput struct {
+	Label string `json:"label"`
+}
+
+func TestReadInput(t *testing.T) {
+	resource := &dsl.Resource{
+		ModelType: dsl.ModelType[fieldsModel],
+		InputType: dsl.ModelType[dtoInput],
+		FromInput: func(input, element any) error {
+			name := input.(*dtoInput).FullName
+			if name == "abort" {
+				return responses.Abort(http.StatusConflict, "name:taken", nil)
+			} else if name == "fail" {
+				return errors.New("failed")
+			}
+			element.(*fieldsModel).Name = name
+			return nil
+		},
+	}
+	makeBody, input := makeInput(resource, func() any { return &fieldsModel{} })
+	cases := []struct {
+		name     string
+		body     string
+		expected any
+		status   int
+	}{
+		{"converts the input", `{"full_name":"x"}`, &fieldsModel{Name: "x"}, 0},
+		{"validates the input", `{"name":"x"}`, nil, http.StatusBadRequest},
+		{"renders the aborted conversions", `{"full_name":"abort"}`, nil, http.StatusConflict},
+		{"renders the failed conversions", `{"full_name":"fail"}`, nil, http.StatusInternalServerError},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(case_.body))
+			request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			recorder := httptest.NewRecorder()
+			ctx := echo.New().NewContext(request, recorder)
+			element, ok, err := readInput(ctx, makeBody, input, validator.New(), slog.Default())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if case_.status != 0 {
+				if ok {
+					t.Fatalf("expected status %d, got the element %v", case_.status, element)
+				} else if recorder.Code != case_.status {
+					t.Fatalf("expected status %d, got %d", case_.status, recorder.Code)
+				}
+			} else if !ok {
+				t.Fatalf("unexpected response: %s", recorder.Body.String())
+			} else if !reflect.DeepEqual(element, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, element)
+			}
+		})
+	}
+}
+
+func TestMakeInputWithoutInputType(t *testing.T) {
+	make_ := func() any { return &fieldsModel{} }
+	if makeBody, input := makeInput(&dsl.Resource{}, make_); input != nil {
+		t.Fatalf("expected no conversion without an input type")
+	} else if _, ok := makeBody().(*fieldsModel); !ok {
+		t.Fatalf("expected the body to be bound to the model type")
+	}
+}
+
+func TestMakeOutputType(t *testing.T) {
+	resource := &dsl.Resource{
+		ModelType:  dsl.ModelType[fieldsModel],
+		OutputType: dsl.ModelType[dtoOutput],
+		ToOutput: func(element, output any) error {
+			model := element.(*fieldsModel)
+			output.(*dtoOutput).Label = model.Name + ":" + model.Secret
+			return nil
+		},
+	}
+	make_ := func() any { return &fieldsModel{} }
+	cases := []struct {
+		name      string
+		writeOnly []string
+		expected  *dtoOutput
+	}{
+		{"converts the element", nil, &dtoOutput{Label: "x:y"}},
+		{"removes the write-only fields first", []string{"secret"}, &dtoOutput{Label: "x:"}},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			element := &fieldsModel{Name: "x", Secret: "y"}
+			if output, err := makeOutput(resource, make_, case_.writeOnly)(element); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if !reflect.DeepEqual(output, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, output)
+			} else if element.Secret != "y" {
+				t.Fatalf("the original element was changed: %v", element)
+			}
+		})
+	}
+}
+
+func TestErrorElement(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected echo.Map
+	}{
+		{
+			"renders aborts", responses.Abort(http.StatusConflict, "name:taken", "x"),
+			echo.Map{"code": "name:taken", "details": "x"},
+		},
+		{"renders other errors as internal", errors.New("failed"), responses.InternalErrorElement()},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if element := errorElement(case_.err, slog.Default()); !reflect.DeepEqual(element, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, element)
+			}
+		})
+	}
+}
@@ -5,49 +5,84 @@ import (
 	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/responses"
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"log/slog"
 	"reflect"
+	"slices"
 )
 
 func registerEndpoints(
 	client *mongo.Client, router *echo.Echo, key string,
-	resource *dsl.Resource, auth *dsl.Auth, resourcesValidatorMaker func() *validator.Validate,
-	listMaxResults int64, logger *slog.Logger,
+	resource *dsl.Resource, auth *dsl.Auth, idempotency *dsl.Idempotency,
+	resourcesValidatorMaker func() *validator.Validate, global *dsl.Global, logger *slog.Logger,
 ) {
 	if resource.Type == dsl.SimpleResource {
-		registerSimpleResourceEndpoints(client, router, key, resource, auth, resourcesValidatorMaker, logger)
+		registerSimpleResourceEndpoints(
+			client, router, key, resource, auth, idempotency, resourcesValidatorMaker, logger,
+		)
+	} else if resource.Type == dsl.ViewResource {
+		registerViewResourceEndpoints(client, router, key, resource, auth, resourcesValidatorMaker, global, logger)
 	} else {
 		registerListResourceEndpoints(
-			client, router, key, resource, auth, resourcesValidatorMaker, listMaxResults, logger,
+			client, router, key, resource, auth, idempotency, resourcesValidatorMaker, global, logger,
 		)
 	}
 }
 
 func registerSimpleResourceEndpoints(
 	client *mongo.Client, router *echo.Echo, key string,
-	resource *dsl.Resource, auth *dsl.Auth, validatorMaker func() *validator.Validate,
-	logger *slog.Logger,
+	resource *dsl.Resource, auth *dsl.Auth, idempotency *dsl.Idempotency,
+	validatorMaker func() *validator.Validate, logger *slog.Logger,
 ) {
-	tmpUpdatesCollection := client.Database("~tmp").Collection("updates")
 	authCollection := client.Database(auth.Db).Collection(auth.Collection)
+	idempotent := makeIdempotent(
+		client.Database(idempotency.Db).Collection(idempotency.Collection), idempotency.TTL, idempotency.Lease,
+		logger,
+	)
 	collection := client.Database(resource.Db).Collection(resource.Collection)
 	filter := resource.Filter
 	softDelete := resource.SoftDelete
 	sort := resource.Sort
 	projection := resource.Projection
 	methods := resource.Methods
-	idGetter, idSetter := makeIDAccessors(resource.ModelType())
+	_, idSetter := makeIDAccessors(resource.ModelType())
+	modelFields := makeModelFields(resource.ModelType())
+	parseFields := makeFieldsParser(modelFields)
 
 	modelType_ := reflect.TypeOf(resource.ModelType())
 	make_ := func() any { return reflect.New(modelType_).Interface() }
 	makeMap := func() any { return &echo.Map{} }
 
-	createOne := makeCreateOne(collection)
-	getOne := makeGetOne(collection, make_, softDelete, filter, projection, sort)
-	replaceOne := makeReplaceOne(collection, filter, softDelete)
-	deleteOne := makeDeleteOne(collection, filter, softDelete)
-	simulatedUpdate := makeSimulatedUpdate(tmpUpdatesCollection, make_)
+	readOnly, immutable, writeOnly := splitFieldModes(resource.FieldModes, modelFields)
+	output := makeOutput(resource, make_, writeOnly)
+	makeBody, input := makeInput(resource, make_)
+
+	versioned := resource.Versioned
+	tracking := Tracking{Versioned: versioned, Audited: resource.Audited, ReadOnly: readOnly, Immutable: immutable}
+	readIfMatch := makeIfMatchReader(versioned, resource.RequireIfMatch)
+
+	createOne := makeCreateOne(collection, tracking)
+	getOne := outputOne(makeGetOne(collection, make_, softDelete, filter, projection, sort), output)
+	if versioned {
+		getOne = versionedGetOne(getOne)
+	}
+	replaceOne := makeReplaceOne(collection, filter, softDelete, tracking)
+	deleteOne := makeDeleteOne(collection, filter, softDelete, tracking)
+	getRaw := makeGetRaw(collection, softDelete, filter, sort)
+	guardedReplaceOne := makeGuardedReplaceOne(collection, filter, softDelete, tracking)
+	patch := makePatch(make_)
+	checkPatchPolicy := makePatchPolicy(
+		resource.PatchPolicy, modelFields, makeInputFields(resource), slices.Concat(readOnly, immutable), writeOnly,
+	)
+	hooks := makeHooks(resource.Hooks, collection, make_, logger)
+
+	// The reads may be cached. Any write invalidates the cache.
+	readOne := getOne
+	invalidateCache := func() {}
+	if resource.CacheTTL > 0 {
+		readOne, invalidateCache = makeCachedGetOne(getOne, resource.CacheTTL)
+	}
 
 	verbs := resource.Verbs
 	if len(verbs) == 0 {
@@ -63,22 +98,27 @@ func registerSimpleResourceEndpoints(
 				if success, err := authenticate(context, authCollection, key, "write"); !success {
 					return err
 				}
-				return simpleCreate(context, createOne, getOne, make_, validatorMaker, logger)
+				defer invalidateCache()
+				return idempotent(context, func() error {
+					return simpleCreate(context, createOne, getOne, hooks, makeBody, input, validatorMaker, logger)
+				})
 			})
 		case dsl.ReadVerb:
 			router.GET("/"+key, func(context echo.Context) error {
 				if success, err := authenticate(context, authCollection, key, "read"); !success {
 					return err
 				}
-				return simpleGet(context, getOne, logger)
+				return simpleGet(context, readOne, parseFields, logger)
 			})
 		case dsl.UpdateVerb:
 			router.PATCH("/"+key, func(context echo.Context) error {
 				if success, err := authenticate(context, authCollection, key, "write"); !success {
 					return err
 				}
+				defer invalidateCache()
 				return simpleUpdate(
-					context, getOne, idGetter, idSetter, replaceOne, makeMap, simulatedUpdate, validatorMaker, logger,
+					context, getRaw, patch, guardedReplaceOne, idSetter, readIfMatch, hooks, output, makeMap,
+					checkPatchPolicy, validatorMaker, logger,
 				)
 			})
 		case dsl.ReplaceVerb:
@@ -86,14 +126,18 @@ func registerSimpleResourceEndpoints(
 				if success, err := authenticate(context, authCollection, key, "write"); !success {
 					return err
 				}
-				return simpleReplace(context, replaceOne, make_, validatorMaker, logger)
+				defer invalidateCache()
+				return simpleReplace(
+					context, replaceOne, getOne, readIfMatch, hooks, makeBody, input, validatorMaker, logger,
+				)
 			})
 		case dsl.DeleteVerb:
 			router.DELETE("/"+key, func(context echo.Context) error {
 				if success, err := authenticate(context, authCollection, key, "delete"); !success {
 					return err
 				}
-				return simpleDelete(context, deleteOne, logger)
+				defer invalidateCache()
+				return simpleDelete(context, deleteOne, getOne, readIfMatch, hooks, logger)
 			})
 		default:
 			slog.Info("Ignoring an unknown verb", "verb", verb)
@@ -113,20 +157,26 @@ func registerSimpleResourceEndpoints(
 		if success, err := authenticate(context, authCollection, key, "write"); !success {
 			return err
 		}
-		return resourceMethod(
-			context, collection, filter, key, dsl.Operation, context.Param("method"), methods, client,
-			validatorMaker, logger,
-		)
+		defer invalidateCache()
+		return idempotent(context, func() error {
+			return resourceMethod(
+				context, collection, filter, key, dsl.Operation, context.Param("method"), methods, client,
+				validatorMaker, logger,
+			)
+		})
 	})
 }
 
 func registerListResourceEndpoints(
 	client *mongo.Client, router *echo.Echo, key string,
-	resource *dsl.Resource, auth *dsl.Auth, validatorMaker func() *validator.Validate,
-	listMaxResults int64, logger *slog.Logger,
+	resource *dsl.Resource, auth *dsl.Auth, idempotency *dsl.Idempotency,
+	validatorMaker func() *validator.Validate, global *dsl.Global, logger *slog.Logger,
 ) {
-	tmpUpdatesCollection := client.Database("~tmp").Collection("updates")
 	authCollection := client.Database(auth.Db).Collection(auth.Collection)
+	idempotent := makeIdempotent(
+		client.Database(idempotency.Db).Collection(idempotency.Collection), idempotency.TTL, idempotency.Lease,
+		logger,
+	)
 	collection := client.Database(resource.Db).Collection(resource.Collection)
 	filter := resource.Filter
 	softDelete := resource.SoftDelete
@@ -135,43 +185,107 @@ func registerListResourceEndpoints(
 	itemProjection := resource.ItemProjection
 	methods := resource.Methods
 	itemMethods := resource.ItemMethods
-	_, idSetter := makeIDAccessors(resource.ModelType())
+	idGetter, idSetter := makeIDAccessors(resource.ModelType())
+	modelFields := makeModelFields(resource.ModelType())
 
 	modelType_ := reflect.TypeOf(resource.ModelType())
 	make_ := func() any { return reflect.New(modelType_).Interface() }
 	makeMap := func() any { return &echo.Map{} }
 
-	createOne := makeCreateOne(collection)
-	getMany := makeGetMany(collection, make_, softDelete, filter, projection, sort)
-	getOne := makeGetOne(collection, make_, softDelete, filter, itemProjection, sort)
-	replaceOne := makeReplaceOne(collection, filter, softDelete)
-	deleteOne := makeDeleteOne(collection, filter, softDelete)
-	simulatedUpdate := makeSimulatedUpdate(tmpUpdatesCollection, make_)
+	encodeCursor, decodeCursor := makeCursorCodec(global.CursorSecret, key)
+	listMaxResults := global.ListMaxResults
+	if resource.ListMaxResults > 0 {
+		listMaxResults = int64(resource.ListMaxResults)
+	}
+	envelope := resource.ListEnvelope
+	textSearch := dsl.HasTextIndex(resource.Indexes)
+	bulkMaxSize := listMaxResults
+	if resource.BulkMaxSize > 0 {
+		bulkMaxSize = int64(resource.BulkMaxSize)
+	}
+	var count CountFunc
+	if resource.ListCount {
+		count = makeCount(collection, softDelete, filter)
+	}
+
+	readOnly, immutable, writeOnly := splitFieldModes(resource.FieldModes, modelFields)
+	output := makeOutput(resource, make_, writeOnly)
+	makeBody, input := makeInput(resource, make_)
+	checkWriteOnly(resource, writeOnly)
+
+	versioned := resource.Versioned
+	tracking := Tracking{Versioned: versioned, Audited: resource.Audited, ReadOnly: readOnly, Immutable: immutable}
+	readIfMatch := makeIfMatchReader(versioned, resource.RequireIfMatch)
+	var revisions *mongo.Collection
+	if resource.History {
+		revisions = historyCollection(client, resource)
+		tracking.Revisions = makeRecordRevision(revisions, logger)
+		tracking.LatestRevision = makeLatestRevision(revisions)
+	}
+	var bumpVersion BumpVersionFunc
+	if versioned {
+		bumpVersion = makeBumpVersion(collection, filter, softDelete)
+	}
+
+	createOne := makeCreateOne(collection, tracking)
+	getMany := outputMany(
+		makeGetMany(collection, make_, softDelete, filter, projection, sort, encodeCursor, decodeCursor), output,
+	)
+	getOne := outputOne(makeGetOne(collection, make_, softDelete, filter, itemProjection, sort), output)
+	if versioned {
+		getOne = versionedGetOne(getOne)
+	}
+	replaceOne := makeReplaceOne(collection, filter, softDelete, tracking)
+	deleteOne := makeDeleteOne(collection, filter, softDelete, tracking)
+	getRaw := makeGetRaw(collection, softDelete, filter, sort)
+	guardedReplaceOne := makeGuardedReplaceOne(collection, filter, softDelete, tracking)
+	var upsertOne UpsertOneFunc
+	if resource.AllowUpsert {
+		upsertOne = makeUpsertOne(collection, filter, softDelete, tracking)
+	}
+	patch := makePatch(make_)
+	checkPatchPolicy := makePatchPolicy(
+		resource.PatchPolicy, modelFields, makeInputFields(resource), slices.Concat(readOnly, immutable), writeOnly,
+	)
+	hooks := makeHooks(resource.Hooks, collection, make_, logger)
+	parseFilter := makeFilterParser(resource.Filterable, modelFields)
+	parseSort := makeSortParser(resource.Sortable, modelFields)
+	parseFields := makeFieldsParser(modelFields)
+	parseGeo := makeGeoParser(dsl.GeoIndexFields(resource.Indexes))
 	itemReadDefined := false
+	createDefined := false
+	bulkCreateDefined := false
+	distinctFields := resource.Distinct
+	for _, field := range distinctFields {
+		if _, ok := modelFields[field]; !ok && field != "_id" {
+			panic("the distinct field is not defined in the model type: " + field)
+		}
+	}
 
 	verbs := resource.Verbs
 	if len(verbs) == 0 {
 		verbs = []dsl.ResourceVerb{
 			dsl.ListVerb, dsl.CreateVerb, dsl.ReadVerb,
 			dsl.UpdateVerb, dsl.ReplaceVerb, dsl.DeleteVerb,
+			dsl.CountVerb, dsl.DistinctVerb, dsl.BulkCreateVerb,
 		}
 	}
 
 	for _, verb := range verbs {
 		switch verb {
 		case dsl.CreateVerb:
-			router.POST("/"+key, func(context echo.Context) error {
-				if success, err := authenticate(context, authCollection, key, "read"); !success {
-					return err
-				}
-				return listCreate(context, createOne, make_, validatorMaker, logger)
-			})
+			createDefined = true
+		case dsl.BulkCreateVerb:
+			bulkCreateDefined = true
 		case dsl.ListVerb:
 			router.GET("/"+key, func(context echo.Context) error {
-				if success, err := authenticate(context, authCollection, key, "write"); !success {
+				if success, err := authenticate(context, authCollection, key, "read"); !success {
 					return err
 				}
-				return listGet(context, getMany, listMaxResults, logger)
+				return listGet(
+					context, getMany, count, parseFilter, parseSort, parseFields, parseGeo, listMaxResults,
+					envelope, textSearch, logger,
+				)
 			})
 		case dsl.ReadVerb:
 			itemReadDefined = true
@@ -180,7 +294,7 @@ func registerListResourceEndpoints(
 					return err
 				}
 				if id, ok, _ := checkId(context, "id_or_method", false); ok {
-					return listItemGet(context, getOne, id, logger)
+					return listItemGet(context, getOne, parseFields, id, logger)
 				} else {
 					return resourceMethod(
 						context, collection, filter, key, dsl.View, context.Param("id_or_method"), methods, client,
@@ -201,7 +315,8 @@ func registerListResourceEndpoints(
 					}
 				} else {
 					return listItemUpdate(
-						context, getOne, idSetter, replaceOne, makeMap, id, simulatedUpdate, validatorMaker, logger,
+						context, getRaw, patch, guardedReplaceOne, idSetter, readIfMatch, hooks, output, makeMap,
+						checkPatchPolicy, id, validatorMaker, logger,
 					)
 				}
 			})
@@ -217,7 +332,10 @@ func registerListResourceEndpoints(
 						return err
 					}
 				} else {
-					return listItemReplace(context, replaceOne, make_, id, validatorMaker, logger)
+					return listItemReplace(
+						context, replaceOne, upsertOne, getOne, readIfMatch, hooks, makeBody, input, id, validatorMaker,
+						logger,
+					)
 				}
 			})
 		case dsl.DeleteVerb:
@@ -232,14 +350,170 @@ func registerListResourceEndpoints(
 						return err
 					}
 				} else {
-					return listItemDelete(context, deleteOne, id, logger)
+					return listItemDelete(context, deleteOne, getOne, readIfMatch, hooks, id, logger)
+				}
+			})
+		case dsl.CountVerb:
+			countAll := makeCount(collection, softDelete, filter)
+			handler := func(context echo.Context) error {
+				if success, err := authenticate(context, authCollection, key, "read"); !success {
+					return err
+				}
+				return listCount(context, countAll, parseFilter, parseGeo, textSearch, logger)
+			}
+			router.HEAD("/"+key, handler)
+			router.GET("/"+key+"/~count", handler)
+		case dsl.DistinctVerb:
+			distinct := makeDistinct(collection, softDelete, filter)
+			router.GET("/"+key+"/~distinct/:field", func(context echo.Context) error {
+				if success, err := authenticate(context, authCollection, key, "read"); !success {
+					return err
+				}
+				return listDistinct(context, distinct, distinctFields, parseFilter, parseGeo, textSearch, logger)
+			})
+		case dsl.BulkUpdateVerb:
+			matchRaw := makeGetMany(
+				collection, func() any { return &bson.Raw{} }, softDelete, filter, nil, nil, nil, nil,
+			)
+			countAll := makeCount(collection, softDelete, filter)
+			router.PATCH("/"+key, func(context echo.Context) error {
+				if success, err := authenticate(context, authCollection, key, "bulk"); !success {
+					return err
+				}
+				return listBulkUpdate(
+					context, matchRaw, countAll, guardedReplaceOne, hooks, makeMap, patch, checkPatchPolicy,
+					validatorMaker, parseFilter, parseGeo, textSearch, bulkMaxSize, logger,
+				)
+			})
+		case dsl.BulkDeleteVerb:
+			matchMany := makeGetMany(collection, make_, softDelete, filter, nil, nil, nil, nil)
+			countAll := makeCount(collection, softDelete, filter)
+			deleteMany := makeDeleteMany(collection, filter, softDelete, tracking)
+			router.DELETE("/"+key, func(context echo.Context) error {
+				if success, err := authenticate(context, authCollection, key, "bulk"); !success {
+					return err
 				}
+				return listBulkDelete(
+					context, matchMany, countAll, idGetter, deleteMany, hooks, parseFilter, parseGeo, textSearch,
+					bulkMaxSize, logger,
+				)
 			})
 		default:
 			slog.Info("Ignoring an unknown verb", "verb", verb)
 		}
 	}
 
+	if createDefined || bulkCreateDefined {
+		var createOne_ CreateOneFunc
+		var createMany CreateManyFunc
+		if createDefined {
+			createOne_ = createOne
+		}
+		if bulkCreateDefined {
+			createMany = makeCreateMany(collection, tracking)
+		}
+		router.POST("/"+key, func(context echo.Context) error {
+			if success, err := authenticate(context, authCollection, key, "write"); !success {
+				return err
+			}
+			return idempotent(context, func() error {
+				return listCreate(
+					context, createOne_, createMany, hooks, makeBody, input, validatorMaker, bulkMaxSize, logger,
+				)
+			})
+		})
+	}
+
+	if resource.Stats != nil {
+		maxGroups := listMaxResults
+		if resource.Stats.MaxGroups > 0 {
+			maxGroups = int64(resource.Stats.MaxGroups)
+		}
+		stats := makeStats(collection, softDelete, filter, maxGroups)
+		parseStats := makeStatsParser(resource.Stats, modelFields)
+		router.GET("/"+key+"/~stats", func(context echo.Context) error {
+			if success, err := authenticate(context, authCollection, key, "read"); !success {
+				return err
+			}
+			return listStats(context, stats, parseStats, parseFilter, parseGeo, textSearch, logger)
+		})
+	}
+
+	if softDelete {
+		// The soft-deleted elements can be listed and restored, with
+		// their own permission.
+		trashFilter_ := trashFilter(filter)
+		getTrash := outputMany(makeGetMany(
+			collection, make_, false, trashFilter_, projection, sort, encodeCursor, decodeCursor,
+		), output)
+		var countTrash CountFunc
+		if resource.ListCount {
+			countTrash = makeCount(collection, false, trashFilter_)
+		}
+		restoreOne := makeRestoreOne(collection, filter, tracking)
+		router.GET("/"+key+"/~trash", func(context echo.Context) error {
+			if success, err := authenticate(context, authCollection, key, "trash"); !success {
+				return err
+			}
+			return listGet(
+				context, getTrash, countTrash, parseFilter, parseSort, parseFields, parseGeo, listMaxResults,
+				envelope, textSearch, logger,
+			)
+		})
+		router.POST("/"+key+"/:id/~restore", func(context echo.Context) error {
+			if success, err := authenticate(context, authCollection, key, "trash"); !success {
+				return err
+			}
+			if id, ok, err := checkId(context, "id", true); !ok {
+				return err
+			} else {
+				return listItemRestore(context, restoreOne, id, logger)
+			}
+		})
+	}
+
+	if resource.History {
+		// The prior versions of the elements can be listed, retrieved
+		// and restored (as a replacement).
+		getRevisions := makeGetRevisions(revisions)
+		getRevision := makeGetRevision(revisions)
+		router.GET("/"+key+"/:id/~revisions", func(context echo.Context) error {
+			if success, err := authenticate(context, authCollection, key, "read"); !success {
+				return err
+			}
+			if id, ok, err := checkId(context, "id", true); !ok {
+				return err
+			} else {
+				return listItemRevisions(context, getRevisions, id, listMaxResults, logger)
+			}
+		})
+		router.GET("/"+key+"/:id/~revisions/:revision", func(context echo.Context) error {
+			if success, err := authenticate(context, authCollection, key, "read"); !success {
+				return err
+			}
+			if id, ok, err := checkId(context, "id", true); !ok {
+				return err
+			} else {
+				return listItemRevision(context, getRevision, make_, output, id, logger)
+			}
+		})
+		router.POST("/"+key+"/:id/~revisions/:revision/~rollback", func(context echo.Context) error {
+			if success, err := authenticate(context, authCollection, key, "write"); !success {
+				return err
+			}
+			if id, ok, err := checkId(context, "id", true); !ok {
+				return err
+			} else {
+				return idempotent(context, func() error {
+					return listItemRollback(
+						context, getRevision, replaceOne, getOne, readIfMatch, hooks, make_, id, validatorMaker,
+						logger,
+					)
+				})
+			}
+		})
+	}
+
 	if !itemReadDefined {
 		router.GET("/"+key+"/:method", func(context echo.Context) error {
 			if success, err := authenticate(context, authCollection, key, "read"); !success {
@@ -256,10 +530,12 @@ func registerListResourceEndpoints(
 		if success, err := authenticate(context, authCollection, key, "write"); !success {
 			return err
 		}
-		return resourceMethod(
-			context, collection, filter, key, dsl.Operation, context.Param("method"), methods, client,
-			validatorMaker, logger,
-		)
+		return idempotent(context, func() error {
+			return resourceMethod(
+				context, collection, filter, key, dsl.Operation, context.Param("method"), methods, client,
+				validatorMaker, logger,
+			)
+		})
 	})
 	router.GET("/"+key+"/:id/:method", func(context echo.Context) error {
 		if success, err := authenticate(context, authCollection, key, "read"); !success {
@@ -274,7 +550,7 @@ func registerListResourceEndpoints(
 		} else {
 			return itemMethod(
 				context, collection, filter, key, dsl.View, id, context.Param("method"), itemMethods, client,
-				validatorMaker, logger,
+				getOne, readIfMatch, bumpVersion, validatorMaker, logger,
 			)
 		}
 	})
@@ -289,10 +565,75 @@ func registerListResourceEndpoints(
 				return err
 			}
 		} else {
-			return itemMethod(
-				context, collection, filter, key, dsl.Operation, id, context.Param("method"), itemMethods, client,
-				validatorMaker, logger,
-			)
+			return idempotent(context, func() error {
+				return itemMethod(
+					context, collection, filter, key, dsl.Operation, id, context.Param("method"), itemMethods, client,
+					getOne, readIfMatch, bumpVersion, validatorMaker, logger,
+				)
+			})
+		}
+	})
+}
+
+func registerViewResourceEndpoints(
+	client *mongo.Client, router *echo.Echo, key string,
+	resource *dsl.Resource, auth *dsl.Auth, validatorMaker func() *validator.Validate,
+	global *dsl.Global, logger *slog.Logger,
+) {
+	authCollection := client.Database(auth.Db).Collection(auth.Collection)
+	collection := client.Database(resource.Db).Collection(resource.Collection)
+	filter := resource.Filter
+	softDelete := resource.SoftDelete
+	sort := resource.Sort
+	projection := resource.Projection
+	modelFields := makeModelFields(resource.ModelType())
+	bindPipeline := makePipelineBinder(resource.Pipeline, resource.Parameters)
+
+	modelType_ := reflect.TypeOf(resource.ModelType())
+	make_ := func() any { return reflect.New(modelType_).Interface() }
+	var makeParams func() any
+	if resource.Parameters != nil {
+		paramsType_ := reflect.TypeOf(resource.Parameters())
+		makeParams = func() any { return reflect.New(paramsType_).Interface() }
+	}
+
+	encodeCursor, decodeCursor := makeCursorCodec(global.CursorSecret, key)
+	listMaxResults := global.ListMaxResults
+	if resource.ListMaxResults > 0 {
+		listMaxResults = int64(resource.ListMaxResults)
+	}
+	envelope := resource.ListEnvelope
+	getMany := makeViewGetMany(
+		collection, make_, softDelete, filter, projection, sort, bindPipeline, encodeCursor, decodeCursor,
+	)
+	var count func(any) CountFunc
+	if resource.ListCount {
+		count = makeViewCount(collection, softDelete, filter, bindPipeline)
+	}
+	parseFilter := makeFilterParser(resource.Filterable, modelFields)
+	parseSort := makeSortParser(resource.Sortable, modelFields)
+	parseFields := makeFieldsParser(modelFields)
+	parseGeo := makeGeoParser(nil)
+
+	router.GET("/"+key, func(context echo.Context) error {
+		if success, err := authenticate(context, authCollection, key, "read"); !success {
+			return err
 		}
+		var params any
+		if makeParams != nil {
+			var ok bool
+			var err error
+			if params, ok, err = readQueryParams(context, makeParams, validatorMaker()); !ok {
+				return err
+			}
+		}
+		var count_ CountFunc
+		if count != nil {
+			count_ = count(params)
+		}
+		return listGet(
+			context, getMany(params), count_, parseFilter, parseSort, parseFields, parseGeo, listMaxResults,
+			envelope, false, logger,
+		)
 	})
 }
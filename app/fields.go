@@ -0,0 +1,208 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// OutputFunc stands for a function that converts an element to its
+// representation in the responses.
+type OutputFunc func(any) (any, error)
+
+// splitFieldModes splits the fields with a mode by that mode. They
+// must be mapped in the model, and the _id cannot have a mode.
+func splitFieldModes(modes dsl.FieldModes, modelFields map[string]reflect.Type) ([]string, []string, []string) {
+	var readOnly, immutable, writeOnly []string
+	for field, mode := range modes {
+		if _, ok := modelFields[field]; !ok || field == "_id" {
+			panic("the field mode is not set on a field defined in the model type: " + field)
+		}
+		switch mode {
+		case dsl.ReadOnlyField:
+			readOnly = append(readOnly, field)
+		case dsl.ImmutableField:
+			immutable = append(immutable, field)
+		case dsl.WriteOnlyField:
+			writeOnly = append(writeOnly, field)
+		}
+	}
+	slices.Sort(readOnly)
+	slices.Sort(immutable)
+	slices.Sort(writeOnly)
+	return readOnly, immutable, writeOnly
+}
+
+// checkWriteOnly ensures that the write-only fields of a resource
+// cannot be revealed by filtering, sorting, getting distinct values
+// or computing statistics.
+func checkWriteOnly(resource *dsl.Resource, writeOnly []string) {
+	hidden := func(path string) bool {
+		return slices.Contains(writeOnly, strings.SplitN(path, ".", 2)[0])
+	}
+	for path := range resource.Filterable {
+		if hidden(path) {
+			panic("the filterable field is write-only: " + path)
+		}
+	}
+	for _, path := range resource.Sortable {
+		if hidden(path) {
+			panic("the sortable field is write-only: " + path)
+		}
+	}
+	for _, path := range resource.Distinct {
+		if hidden(path) {
+			panic("the distinct field is write-only: " + path)
+		}
+	}
+	if resource.Stats != nil {
+		for _, path := range resource.Stats.GroupBy {
+			if hidden(path) {
+				panic("the stats group-by field is write-only: " + path)
+			}
+		}
+		for path := range resource.Stats.Accumulators {
+			if hidden(path) {
+				panic("the stats accumulated field is write-only: " + path)
+			}
+		}
+	}
+}
+
+// jsonNames returns the names, in JSON, of some fields of a model
+// struct (given their names in BSON). The fields ignored in JSON are
+// not returned.
+func jsonNames(template any, fields []string) []string {
+	var names []string
+	var collect func(typ reflect.Type)
+	collect = func(typ reflect.Type) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			tagParts := strings.Split(field.Tag.Get("bson"), ",")
+			name := tagParts[0]
+			if slices.Contains(tagParts[1:], "inline") && field.Type.Kind() == reflect.Struct {
+				collect(field.Type)
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			if !slices.Contains(fields, name) {
+				continue
+			}
+			jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+			if jsonName == "-" {
+				continue
+			} else if jsonName == "" {
+				jsonName = field.Name
+			}
+			names = append(names, jsonName)
+		}
+	}
+	collect(reflect.TypeOf(template))
+	return names
+}
+
+// makeOutput makes a function that converts an element to its
+// representation: an element of the output type, if any, or the
+// element itself otherwise. The write-only fields are removed from
+// the representation or, if there is an output type, from the element
+// before converting it. It returns nil when there is nothing to do.
+func makeOutput(resource *dsl.Resource, make_ func() any, writeOnly []string) OutputFunc {
+	if resource.OutputType != nil {
+		outputType := reflect.TypeOf(resource.OutputType())
+		if outputType.Kind() != reflect.Struct {
+			panic("the output type is not a struct: " + outputType.Name())
+		}
+		toOutput := resource.ToOutput
+		return func(element any) (any, error) {
+			if len(writeOnly) != 0 {
+				document, err := withFields(element)
+				if err != nil {
+					return nil, err
+				}
+				element = make_()
+				if raw, err := bson.Marshal(withoutFields(document, writeOnly...)); err != nil {
+					return nil, err
+				} else if err := bson.Unmarshal(raw, element); err != nil {
+					return nil, err
+				}
+			}
+			output := reflect.New(outputType).Interface()
+			if err := toOutput(element, output); err != nil {
+				return nil, err
+			}
+			return output, nil
+		}
+	}
+
+	hidden := jsonNames(resource.ModelType(), writeOnly)
+	if len(hidden) == 0 {
+		return nil
+	}
+	return func(element any) (any, error) {
+		var fields map[string]json.RawMessage
+		if content, err := json.Marshal(element); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal(content, &fields); err != nil {
+			return nil, err
+		}
+		for _, name := range hidden {
+			delete(fields, name)
+		}
+		return fields, nil
+	}
+}
+
+// render converts an element to its representation, if there is an
+// output function.
+func render(output OutputFunc, element any) (any, error) {
+	if output == nil {
+		return element, nil
+	}
+	return output(element)
+}
+
+// outputOne wraps a function that gets one element so the element
+// is converted to its representation.
+func outputOne(getOne GetOneFunc, output OutputFunc) GetOneFunc {
+	if output == nil {
+		return getOne
+	}
+	return func(ctx echo.Context, id primitive.ObjectID, fields ...string) (any, ElementMeta, error) {
+		element, meta, err := getOne(ctx, id, fields...)
+		if err != nil {
+			return element, meta, err
+		}
+		element, err = output(element)
+		return element, meta, err
+	}
+}
+
+// outputMany wraps a function that gets many elements so the elements
+// are converted to their representation.
+func outputMany(getMany GetManyFunc, output OutputFunc) GetManyFunc {
+	if output == nil {
+		return getMany
+	}
+	return func(ctx echo.Context, query ListQuery) ([]any, string, error) {
+		elements, next, err := getMany(ctx, query)
+		if err != nil {
+			return elements, next, err
+		}
+		for index, element := range elements {
+			if elements[index], err = output(element); err != nil {
+				return nil, "", err
+			}
+		}
+		return elements, next, nil
+	}
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// fieldsInner is a struct inlined in the model used to test the
+// field modes.
+type fieldsInner struct {
+	Code string `bson:"code"`
+}
+
+// fieldsModel is the model type used to test the field modes.
+type fieldsModel struct {
+	Name   string      `bson:"name" json:"name"`
+	Secret string      `bson:"secret" json:"secret,omitempty"`
+	Hidden string      `bson:"hidden" json:"-"`
+	Inner  fieldsInner `bson:"inner,inline" json:"-"`
+}
+
+func TestSplitFieldModes(t *testing.T) {
+	readOnly, immutable, writeOnly := splitFieldModes(dsl.FieldModes{
+		"name": dsl.ImmutableField, "secret": dsl.WriteOnlyField, "hidden": dsl.ReadOnlyField, "code": dsl.ReadOnlyField,
+	}, makeModelFields(fieldsModel{}))
+	if expected := []string{"code", "hidden"}; !reflect.DeepEqual(readOnly, expected) {
+		t.Fatalf("expected the read-only fields %v, got %v", expected, readOnly)
+	} else if expected := []string{"name"}; !reflect.DeepEqual(immutable, expected) {
+		t.Fatalf("expected the immutable fields %v, got %v", expected, immutable)
+	} else if expected := []string{"secret"}; !reflect.DeepEqual(writeOnly, expected) {
+		t.Fatalf("expected the write-only fields %v, got %v", expected, writeOnly)
+	}
+}
+
+func TestFieldModesMisconfiguration(t *testing.T) {
+	writeOnly := []string{"secret"}
+	cases := []struct {
+		name string
+		run  func()
+	}{
+		{"panics on unmapped fields", func() {
+			splitFieldModes(dsl.FieldModes{"missing": dsl.ReadOnlyField}, makeModelFields(fieldsModel{}))
+		}},
+		{"panics on the _id", func() {
+			splitFieldModes(dsl.FieldModes{"_id": dsl.ReadOnlyField}, makeModelFields(fieldsModel{}))
+		}},
+		{"panics on filterable write-only fields", func() {
+			checkWriteOnly(&dsl.Resource{Filterable: dsl.Filterable{"secret.a": {dsl.FilterEq}}}, writeOnly)
+		}},
+		{"panics on sortable write-only fields", func() {
+			checkWriteOnly(&dsl.Resource{Sortable: []string{"secret"}}, writeOnly)
+		}},
+		{"panics on distinct write-only fields", func() {
+			checkWriteOnly(&dsl.Resource{Distinct: []string{"secret"}}, writeOnly)
+		}},
+		{"panics on grouping by write-only fields", func() {
+			checkWriteOnly(&dsl.Resource{Stats: &dsl.Stats{GroupBy: []string{"secret"}}}, writeOnly)
+		}},
+		{"panics on accumulating write-only fields", func() {
+			checkWriteOnly(&dsl.Resource{Stats: &dsl.Stats{
+				Accumulators: map[string][]dsl.StatsAccumulator{"secret": {dsl.StatsSum}},
+			}}, writeOnly)
+		}},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic")
+				}
+			}()
+			case_.run()
+		})
+	}
+
+	// Other fields can be used.
+	checkWriteOnly(&dsl.Resource{
+		Filterable: dsl.Filterable{"secrets": {dsl.FilterEq}}, Sortable: []string{"name"},
+		Stats: &dsl.Stats{GroupBy: []string{"name"}},
+	}, writeOnly)
+}
+
+func TestJSONNames(t *testing.T) {
+	cases := []struct {
+		name     string
+		fields   []string
+		expected []string
+	}{
+		{"tells the JSON names", []string{"secret", "name"}, []string{"name", "secret"}},
+		{"tells the inlined fields", []string{"code"}, []string{"Code"}},
+		{"skips the fields ignored in JSON", []string{"hidden"}, nil},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if names := jsonNames(fieldsModel{}, case_.fields); !reflect.DeepEqual(names, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, names)
+			}
+		})
+	}
+}
+
+func TestMakeOutputWriteOnly(t *testing.T) {
+	resource := &dsl.Resource{ModelType: dsl.ModelType[fieldsModel]}
+	if output := makeOutput(resource, nil, nil); output != nil {
+		t.Fatalf("expected no output function without write-only fields")
+	}
+
+	output := makeOutput(resource, nil, []string{"secret"})
+	element := &fieldsModel{Name: "x", Secret: "y"}
+	ctx, recorder := newTestContext(http.MethodGet, "/", nil)
+	if rendered, err := render(output, element); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := ctx.JSON(http.StatusOK, rendered); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if body, expected := recorder.Body.String(), `{"name":"x"}`+"\n"; body != expected {
+		t.Fatalf("expected %s, got %s", expected, body)
+	} else if element.Secret != "y" {
+		t.Fatalf("the original element was changed: %v", element)
+	}
+}
+
+func TestReadOnlyDocument(t *testing.T) {
+	ctx, _ := newTestContext(http.MethodPost, "/", nil)
+	tracking := Tracking{ReadOnly: []string{"hidden", "code"}}
+	element := &fieldsModel{Name: "x", Hidden: "y", Inner: fieldsInner{Code: "z"}}
+	if document, err := tracking.document(ctx, element, ElementMeta{}, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if keys := sortKeys(document); !reflect.DeepEqual(keys, []string{"name", "secret", modifiedAtField}) {
+		t.Fatalf("expected the read-only fields to be discarded, got %v", document)
+	}
+}
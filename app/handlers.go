@@ -1,7 +1,10 @@
 package app
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
 	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/requests"
 	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/responses"
@@ -10,7 +13,11 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"io"
 	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -27,6 +34,19 @@ func validate(context echo.Context, value any, validator_ *validator.Validate) (
 	return true, nil
 }
 
+// validationErrorElement builds the message of the validation error
+// of a single element (nil if there is no error).
+func validationErrorElement(err error) echo.Map {
+	var errVE validator.ValidationErrors
+	if err == nil {
+		return nil
+	} else if errors.As(err, &errVE) {
+		return responses.InvalidFormatElement(errVE)
+	} else {
+		return responses.UnexpectedFormatElement()
+	}
+}
+
 // readJSONBody attempts to read a JSON body from the request and parse the object.
 func readJSONBody(context echo.Context, make_ func() any, validator_ *validator.Validate) (any, bool, error) {
 	body := make_()
@@ -38,15 +58,37 @@ func readJSONBody(context echo.Context, make_ func() any, validator_ *validator.
 	}
 }
 
+// readQueryParams attempts to read the query string parameters into an object.
+func readQueryParams(context echo.Context, make_ func() any, validator_ *validator.Validate) (any, bool, error) {
+	params := make_()
+
+	if err := (&echo.DefaultBinder{}).BindQueryParams(context, params); err != nil {
+		return nil, false, responses.UnexpectedFormat(context)
+	} else if valid, err := validate(context, params, validator_); !valid {
+		return nil, false, err
+	} else {
+		return params, true, nil
+	}
+}
+
 // simpleCreate is the full handler of the POST endpoint for simple resources.
 func simpleCreate(
-	ctx echo.Context, createOne CreateOneFunc, getOne GetOneFunc, make_ func() any,
+	ctx echo.Context, createOne CreateOneFunc, getOne GetOneFunc, hooks *Hooks, makeBody func() any, input InputFunc,
 	validatorMaker func() *validator.Validate, logger *slog.Logger,
 ) error {
-	if _, err := getOne(ctx, primitive.NilObjectID); err == nil {
+	if _, _, err := getOne(ctx, primitive.NilObjectID); err == nil {
 		return responses.AlreadyExists(ctx)
-	} else if parsed, ok, err := readJSONBody(ctx, make_, validatorMaker()); ok {
-		if id, err := createOne(ctx, parsed); err == nil {
+	} else if parsed, ok, err := readInput(ctx, makeBody, input, validatorMaker(), logger); ok {
+		if ok, err := hooks.beforeCreate(ctx, parsed); !ok {
+			return err
+		} else if ok, err := hooks.revalidate(ctx, parsed, validatorMaker()); !ok {
+			return err
+		}
+		if id, meta, err := createOne(ctx, parsed); err == nil {
+			if ok, err := hooks.afterCreate(ctx, id, parsed); !ok {
+				return err
+			}
+			setETag(ctx, meta)
 			return responses.Created(ctx, id)
 		} else if mongo.IsDuplicateKeyError(err) {
 			return responses.DuplicateKey(ctx)
@@ -59,12 +101,37 @@ func simpleCreate(
 	}
 }
 
+// okWithElement renders a retrieved element, telling its ETag and (if
+// known) its Last-Modified time. If the client already has the current
+// representation of the element, nothing is rendered (304).
+func okWithElement(ctx echo.Context, element any, meta ElementMeta, logger *slog.Logger) error {
+	tag, err := elementETag(element, meta)
+	if err != nil {
+		logger.Error("An error occurred: " + err.Error())
+		return responses.InternalError(ctx)
+	}
+	header := ctx.Response().Header()
+	header.Set("ETag", tag)
+	if !meta.ModifiedAt.IsZero() {
+		header.Set("Last-Modified", meta.ModifiedAt.UTC().Format(http.TimeFormat))
+	}
+	if notModified(ctx, tag, meta) {
+		return ctx.NoContent(http.StatusNotModified)
+	}
+	return responses.OkWith(ctx, element)
+}
+
 // simpleGet is the full handler of the GET endpoint for simple resources.
 func simpleGet(
-	ctx echo.Context, getOne GetOneFunc, logger *slog.Logger,
+	ctx echo.Context, getOne GetOneFunc, parseFields FieldsParserFunc, logger *slog.Logger,
 ) error {
-	if element, err := getOne(ctx, primitive.NilObjectID); err == nil {
-		return responses.OkWith(ctx, element)
+	fields, ok, err := parseFields(ctx)
+	if !ok {
+		return err
+	}
+
+	if element, meta, err := getOne(ctx, primitive.NilObjectID, fields...); err == nil {
+		return okWithElement(ctx, element, meta, logger)
 	} else {
 		return responses.FindOneOperationError(ctx, err, logger)
 	}
@@ -72,75 +139,223 @@ func simpleGet(
 
 // simpleDelete is the full handler of the DELETE endpoint for simple resources.
 func simpleDelete(
-	ctx echo.Context, deleteOne DeleteOneFunc, logger *slog.Logger,
+	ctx echo.Context, deleteOne DeleteOneFunc, getOne GetOneFunc, readIfMatch IfMatchReaderFunc, hooks *Hooks,
+	logger *slog.Logger,
 ) error {
-	if deleted, err := deleteOne(ctx, primitive.NilObjectID); err != nil {
+	return deleteItem(ctx, deleteOne, getOne, readIfMatch, hooks, primitive.NilObjectID, logger)
+}
+
+// notMatched renders the response when a write did not match any
+// element: if there were expected versions and the element exists,
+// then it has another version (412). Otherwise, it was not found.
+func notMatched(
+	ctx echo.Context, getOne GetOneFunc, id primitive.ObjectID, versions []int64, logger *slog.Logger,
+) error {
+	if versions == nil {
+		return responses.NotFound(ctx)
+	} else if _, _, err := getOne(ctx, id, "_id"); err == nil {
+		return responses.PreconditionFailed(ctx)
+	} else {
+		return responses.FindOneOperationError(ctx, err, logger)
+	}
+}
+
+// deleteItem deletes an element, honouring the If-Match header.
+func deleteItem(
+	ctx echo.Context, deleteOne DeleteOneFunc, getOne GetOneFunc, readIfMatch IfMatchReaderFunc, hooks *Hooks,
+	id primitive.ObjectID, logger *slog.Logger,
+) error {
+	versions, ok, err := readIfMatch(ctx)
+	if !ok {
+		return err
+	} else if ok, err := hooks.beforeDelete(ctx, id); !ok {
+		return err
+	}
+
+	if deleted, err := deleteOne(ctx, id, versions); err != nil {
 		logger.Error("An error occurred: " + err.Error())
 		return responses.InternalError(ctx)
 	} else if !deleted {
-		return responses.NotFound(ctx)
+		return notMatched(ctx, getOne, id, versions, logger)
+	} else if ok, err := hooks.afterDelete(ctx, id); !ok {
+		return err
 	} else {
 		return responses.Ok(ctx)
 	}
 }
 
-// simpleUpdate is the full handler of the PATCH endpoint for simple resources.
-func simpleUpdate(
-	ctx echo.Context, getOne GetOneFunc, idGetter IDGetter, idSetter IDSetter, replaceOne ReplaceOneFunc,
-	makeMap func() any, simulatedUpdate SimulatedUpdateFunc, validatorMaker func() *validator.Validate,
+// replaceItem replaces an element, honouring the If-Match header.
+func replaceItem(
+	ctx echo.Context, replaceOne ReplaceOneFunc, getOne GetOneFunc, readIfMatch IfMatchReaderFunc, hooks *Hooks,
+	makeBody func() any, input InputFunc, id primitive.ObjectID, validatorMaker func() *validator.Validate,
 	logger *slog.Logger,
 ) error {
-	if element, err := getOne(ctx, primitive.NilObjectID); err == nil {
-		if updates, success, err := readJSONBody(ctx, makeMap, nil); success {
-			id := idGetter(element)
-			if result, err := simulatedUpdate(ctx, id, element, updates); err != nil {
-				logger.Error("An error occurred: " + err.Error())
-				return responses.InternalError(ctx)
-			} else if valid, err := validate(ctx, result, validatorMaker()); !valid {
-				return err
-			} else if updated, err := replaceOne(ctx, id, result); err != nil {
-				logger.Error("An error occurred: " + err.Error())
-				return responses.InternalError(ctx)
-			} else if updated {
-				idSetter(result, id)
-				return responses.OkWith(ctx, result)
-			} else {
-				return responses.NotFound(ctx)
-			}
-		} else {
+	versions, ok, err := readIfMatch(ctx)
+	if !ok {
+		return err
+	}
+
+	if replacement, ok, err := readInput(ctx, makeBody, input, validatorMaker(), logger); ok {
+		if ok, err := hooks.beforeReplace(ctx, id, replacement); !ok {
+			return err
+		} else if ok, err := hooks.revalidate(ctx, replacement, validatorMaker()); !ok {
 			return err
+		} else if ok, meta, err := replaceOne(ctx, id, replacement, versions); err != nil {
+			logger.Error("An error occurred: " + err.Error())
+			return responses.InternalError(ctx)
+		} else if !ok {
+			return notMatched(ctx, getOne, id, versions, logger)
+		} else if ok, err := hooks.afterUpdate(ctx, id, replacement); !ok {
+			return err
+		} else {
+			setETag(ctx, meta)
+			return responses.Ok(ctx)
 		}
 	} else {
-		return responses.FindOneOperationError(ctx, err, logger)
+		return err
 	}
 }
 
-// simpleReplace is the full handler of the PUT endpoint for simple resources.
-func simpleReplace(
-	ctx echo.Context, replaceOne ReplaceOneFunc, make_ func() any, validatorMaker func() *validator.Validate,
-	logger *slog.Logger,
+// readPatch reads the patch operations from the request body, and
+// checks them against the resource's patch policy. The body format is
+// chosen by the Content-Type: a JSON Merge Patch, a JSON Patch, or
+// (by default) a document of update operators.
+func readPatch(ctx echo.Context, makeMap func() any, checkPolicy PatchPolicyFunc) ([]PatchOperation, bool, error) {
+	var operations []PatchOperation
+	var errors_ map[string][]string
+	contentType := strings.ToLower(ctx.Request().Header.Get("Content-Type"))
+	if strings.Contains(contentType, mergePatchContentType) {
+		var patch map[string]any
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&patch); err != nil || patch == nil {
+			return nil, false, responses.UnexpectedFormat(ctx)
+		}
+		operations, errors_ = parseMergePatch(patch)
+	} else if strings.Contains(contentType, jsonPatchContentType) {
+		var patch []any
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&patch); err != nil {
+			return nil, false, responses.UnexpectedFormat(ctx)
+		}
+		operations, errors_ = parseJSONPatch(patch)
+	} else if updates, ok, err := readJSONBody(ctx, makeMap, nil); !ok {
+		return nil, false, err
+	} else {
+		operations, errors_ = parsePatch(*updates.(*echo.Map))
+	}
+
+	if len(errors_) != 0 {
+		return nil, false, responses.InvalidPatch(ctx, errors_)
+	} else if errors_ := checkPolicy(operations); len(errors_) != 0 {
+		return nil, false, responses.InvalidPatch(ctx, errors_)
+	} else {
+		return operations, true, nil
+	}
+}
+
+// patchOne applies the patch operations to an element, validates the
+// result and stores it, unless the element changed meanwhile. If there
+// are expected versions, the element must have one of them. The stored
+// element is rendered.
+func patchOne(
+	ctx echo.Context, getRaw GetRawFunc, patch PatchFunc, replaceOne GuardedReplaceOneFunc, idSetter IDSetter,
+	hooks *Hooks, output OutputFunc, id primitive.ObjectID, versions []int64, operations []PatchOperation,
+	validatorMaker func() *validator.Validate, logger *slog.Logger,
 ) error {
-	if replacement, ok, err := readJSONBody(ctx, make_, validatorMaker()); ok {
-		if ok, err := replaceOne(ctx, primitive.NilObjectID, replacement); err != nil {
+	if original, err := getRaw(ctx, id); err != nil {
+		return responses.FindOneOperationError(ctx, err, logger)
+	} else if versions != nil && !slices.Contains(versions, readMeta(original).Version) {
+		return responses.PreconditionFailed(ctx)
+	} else if result, errors_, err := patch(original, operations); err != nil {
+		logger.Error("An error occurred: " + err.Error())
+		return responses.InternalError(ctx)
+	} else if len(errors_) != 0 {
+		return responses.InvalidPatch(ctx, errors_)
+	} else if valid, err := validate(ctx, result, validatorMaker()); !valid {
+		return err
+	} else if ok, err := hooks.beforeUpdate(ctx, id, original, result); !ok {
+		return err
+	} else if ok, err := hooks.revalidate(ctx, result, validatorMaker()); !ok {
+		return err
+	} else if updated, meta, err := replaceOne(ctx, original, result); err != nil {
+		logger.Error("An error occurred: " + err.Error())
+		return responses.InternalError(ctx)
+	} else if !updated {
+		return responses.ConcurrentModification(ctx)
+	} else {
+		if id, ok := original.Lookup("_id").ObjectIDOK(); ok {
+			idSetter(result, id)
+		}
+		if ok, err := hooks.afterUpdate(ctx, id, result); !ok {
+			return err
+		}
+		setETag(ctx, meta)
+		if rendered, err := render(output, result); err != nil {
 			logger.Error("An error occurred: " + err.Error())
 			return responses.InternalError(ctx)
-		} else if !ok {
-			return responses.NotFound(ctx)
 		} else {
-			return responses.Ok(ctx)
+			return responses.OkWith(ctx, rendered)
 		}
-	} else {
+	}
+}
+
+// simpleUpdate is the full handler of the PATCH endpoint for simple resources.
+func simpleUpdate(
+	ctx echo.Context, getRaw GetRawFunc, patch PatchFunc, replaceOne GuardedReplaceOneFunc, idSetter IDSetter,
+	readIfMatch IfMatchReaderFunc, hooks *Hooks, output OutputFunc, makeMap func() any, checkPolicy PatchPolicyFunc,
+	validatorMaker func() *validator.Validate, logger *slog.Logger,
+) error {
+	if versions, ok, err := readIfMatch(ctx); !ok {
 		return err
+	} else if operations, ok, err := readPatch(ctx, makeMap, checkPolicy); !ok {
+		return err
+	} else {
+		return patchOne(
+			ctx, getRaw, patch, replaceOne, idSetter, hooks, output, primitive.NilObjectID, versions, operations,
+			validatorMaker, logger,
+		)
 	}
 }
 
+// simpleReplace is the full handler of the PUT endpoint for simple resources.
+func simpleReplace(
+	ctx echo.Context, replaceOne ReplaceOneFunc, getOne GetOneFunc, readIfMatch IfMatchReaderFunc, hooks *Hooks,
+	makeBody func() any, input InputFunc, validatorMaker func() *validator.Validate, logger *slog.Logger,
+) error {
+	return replaceItem(
+		ctx, replaceOne, getOne, readIfMatch, hooks, makeBody, input, primitive.NilObjectID, validatorMaker, logger,
+	)
+}
+
 // listCreate is the full handler of the POST endpoint for list resources.
 func listCreate(
-	ctx echo.Context, createOne CreateOneFunc, make_ func() any, validatorMaker func() *validator.Validate,
-	logger *slog.Logger,
+	ctx echo.Context, createOne CreateOneFunc, createMany CreateManyFunc, hooks *Hooks, makeBody func() any,
+	input InputFunc, validatorMaker func() *validator.Validate, bulkMaxSize int64, logger *slog.Logger,
 ) error {
-	if parsed, ok, err := readJSONBody(ctx, make_, validatorMaker()); ok {
-		if id, err := createOne(ctx, parsed); err == nil {
+	if createMany != nil {
+		if body, err := io.ReadAll(ctx.Request().Body); err != nil {
+			return responses.UnexpectedFormat(ctx)
+		} else if trimmed := bytes.TrimSpace(body); len(trimmed) != 0 && trimmed[0] == '[' {
+			return listBulkCreate(
+				ctx, trimmed, createMany, hooks, makeBody, input, validatorMaker, bulkMaxSize, logger,
+			)
+		} else {
+			ctx.Request().Body = io.NopCloser(bytes.NewReader(body))
+		}
+	}
+	if createOne == nil {
+		return responses.MethodNotAllowed(ctx)
+	}
+
+	if parsed, ok, err := readInput(ctx, makeBody, input, validatorMaker(), logger); ok {
+		if ok, err := hooks.beforeCreate(ctx, parsed); !ok {
+			return err
+		} else if ok, err := hooks.revalidate(ctx, parsed, validatorMaker()); !ok {
+			return err
+		}
+		if id, meta, err := createOne(ctx, parsed); err == nil {
+			if ok, err := hooks.afterCreate(ctx, id, parsed); !ok {
+				return err
+			}
+			setETag(ctx, meta)
 			return responses.Created(ctx, id)
 		} else if mongo.IsDuplicateKeyError(err) {
 			return responses.DuplicateKey(ctx)
@@ -152,29 +367,549 @@ func listCreate(
 	}
 }
 
+// listBulkCreate is the handler of the POST endpoint for list resources
+// when the body is a JSON array. Every element is validated and, in
+// ordered mode (the default), nothing is created if any of them is
+// invalid and the creation stops at the first failed element. In
+// unordered mode (ordered=false), the valid elements are created even
+// when some others are invalid or fail.
+func listBulkCreate(
+	ctx echo.Context, body []byte, createMany CreateManyFunc, hooks *Hooks, makeBody func() any, input InputFunc,
+	validatorMaker func() *validator.Validate, bulkMaxSize int64, logger *slog.Logger,
+) error {
+	ordered := true
+	if param := strings.TrimSpace(ctx.QueryParam("ordered")); param != "" {
+		if value, err := strconv.ParseBool(param); err != nil {
+			return responses.InvalidQuery(ctx, map[string][]string{"ordered": {"syntax"}})
+		} else {
+			ordered = value
+		}
+	}
+
+	if !strings.Contains(strings.ToLower(ctx.Request().Header.Get("Content-Type")), "application/json") {
+		return responses.UnexpectedFormat(ctx)
+	}
+	var elements []json.RawMessage
+	if err := json.Unmarshal(body, &elements); err != nil || len(elements) == 0 {
+		return responses.UnexpectedFormat(ctx)
+	} else if int64(len(elements)) > bulkMaxSize {
+		return responses.BulkTooLarge(ctx, bulkMaxSize)
+	}
+
+	// Parse and validate all the elements.
+	validator_ := validatorMaker()
+	errors_ := map[string]echo.Map{}
+	var indices []int
+	var contents []any
+	for index, element := range elements {
+		parsed := makeBody()
+		if err := json.Unmarshal(element, parsed); err != nil {
+			errors_[strconv.Itoa(index)] = responses.UnexpectedFormatElement()
+		} else if message := validationErrorElement(validator_.Struct(parsed)); message != nil {
+			errors_[strconv.Itoa(index)] = message
+		} else if converted, err := convertInput(input, parsed); err != nil {
+			errors_[strconv.Itoa(index)] = errorElement(err, logger)
+		} else {
+			indices = append(indices, index)
+			contents = append(contents, converted)
+		}
+	}
+	if len(errors_) != 0 && (ordered || len(contents) == 0) {
+		return responses.BulkInvalid(ctx, errors_)
+	}
+	for _, content := range contents {
+		if ok, err := hooks.beforeCreate(ctx, content); !ok {
+			return err
+		}
+	}
+
+	// Validate again the elements the hooks changed, keeping the valid ones.
+	var validIndices []int
+	var validContents []any
+	for position, content := range contents {
+		if message := hooks.revalidateElement(content, validator_); message != nil {
+			errors_[strconv.Itoa(indices[position])] = message
+		} else {
+			validIndices = append(validIndices, indices[position])
+			validContents = append(validContents, content)
+		}
+	}
+	indices, contents = validIndices, validContents
+	if len(errors_) != 0 && (ordered || len(contents) == 0) {
+		return responses.BulkInvalid(ctx, errors_)
+	}
+
+	// Create the valid elements.
+	ids, failed, unconcerned, err := createMany(ctx, contents, ordered)
+	if err != nil {
+		logger.Error("An error occurred: " + err.Error())
+		return responses.InternalError(ctx)
+	} else if unconcerned {
+		logger.Warn("The write concern was not satisfied for a bulk creation")
+	}
+	result := make([]any, len(elements))
+	for position, index := range indices {
+		result[index] = ids[position]
+		if err, ok := failed[position]; !ok {
+			if id, ok := ids[position].(primitive.ObjectID); ok {
+				if message := hooks.afterCreateElement(ctx, id, contents[position]); message != nil {
+					errors_[strconv.Itoa(index)] = message
+				}
+			}
+		} else if errors.Is(err, errNotAttempted) {
+			errors_[strconv.Itoa(index)] = responses.NotAttemptedElement()
+		} else if mongo.IsDuplicateKeyError(err) {
+			errors_[strconv.Itoa(index)] = responses.DuplicateKeyElement()
+		} else {
+			logger.Error("An error occurred: " + err.Error())
+			errors_[strconv.Itoa(index)] = responses.InternalErrorElement()
+		}
+	}
+	if ctx.Response().Committed {
+		// A hook rendered the response by itself.
+		return nil
+	}
+	return responses.BulkCreated(ctx, result, errors_, unconcerned)
+}
+
+// readBulkCriteria reads the filtering criteria for the bulk update
+// and delete endpoints, and the "dry_run" and "confirm" query string
+// parameters. Unless it is a dry run, the confirmation is mandatory.
+func readBulkCriteria(
+	ctx echo.Context, parseFilter FilterParserFunc, parseGeo GeoParserFunc, textSearch bool,
+) (ListQuery, bool, bool, error) {
+	query, ok, err := readListCriteria(ctx, parseFilter, parseGeo, textSearch)
+	if !ok {
+		return query, false, false, err
+	} else if query.Geo != nil && query.Geo.Near {
+		return query, false, false, responses.InvalidQuery(ctx, map[string][]string{"near": {"bulk"}})
+	}
+
+	flags := map[string]bool{}
+	for _, name := range []string{"dry_run", "confirm"} {
+		if param := strings.TrimSpace(ctx.QueryParam(name)); param != "" {
+			if value, err := strconv.ParseBool(param); err != nil {
+				return query, false, false, responses.InvalidQuery(ctx, map[string][]string{name: {"syntax"}})
+			} else {
+				flags[name] = value
+			}
+		}
+	}
+	if !flags["dry_run"] && !flags["confirm"] {
+		return query, false, false, responses.InvalidQuery(ctx, map[string][]string{"confirm": {"required"}})
+	}
+	return query, flags["dry_run"], true, nil
+}
+
+// matchBulk gets all the elements matched by a bulk operation, up to
+// the maximum allowed. If there are more, it fails.
+func matchBulk(
+	ctx echo.Context, matchMany GetManyFunc, query ListQuery, maxAffected int64, logger *slog.Logger,
+) ([]any, bool, error) {
+	query.PageSize = maxAffected + 1
+	if elements, _, err := matchMany(ctx, query); err != nil {
+		logger.Error("An error occurred: " + err.Error())
+		return nil, false, responses.InternalError(ctx)
+	} else if int64(len(elements)) > maxAffected {
+		return nil, false, responses.BulkTooLarge(ctx, maxAffected)
+	} else {
+		return elements, true, nil
+	}
+}
+
+// listBulkUpdate is the full handler of the PATCH endpoint for list
+// resources. It applies the same update to all the elements matching
+// the filtering criteria (up to a maximum). Every updated element is
+// validated, and nothing is updated if any of them is invalid. Each
+// element is only stored if it did not change since it was matched,
+// and the ones that changed are reported as concurrent modifications.
+// In a dry run, it only tells how many elements match the criteria.
+func listBulkUpdate(
+	ctx echo.Context, matchRaw GetManyFunc, count CountFunc, replaceOne GuardedReplaceOneFunc,
+	hooks *Hooks, makeMap func() any, patch PatchFunc, checkPolicy PatchPolicyFunc, validatorMaker func() *validator.Validate,
+	parseFilter FilterParserFunc, parseGeo GeoParserFunc, textSearch bool, maxAffected int64,
+	logger *slog.Logger,
+) error {
+	query, dryRun, ok, err := readBulkCriteria(ctx, parseFilter, parseGeo, textSearch)
+	if !ok {
+		return err
+	}
+	if dryRun {
+		if matched, err := count(ctx, query); err != nil {
+			logger.Error("An error occurred: " + err.Error())
+			return responses.InternalError(ctx)
+		} else {
+			return responses.OkWith(ctx, echo.Map{"matched": matched})
+		}
+	}
+
+	operations, ok, err := readPatch(ctx, makeMap, checkPolicy)
+	if !ok {
+		return err
+	}
+	elements, ok, err := matchBulk(ctx, matchRaw, query, maxAffected, logger)
+	if !ok {
+		return err
+	}
+
+	// Compute and validate all the updated elements.
+	validator_ := validatorMaker()
+	originals := make([]bson.Raw, len(elements))
+	ids := make([]primitive.ObjectID, len(elements))
+	results := make([]any, len(elements))
+	errors_ := map[string]echo.Map{}
+	for index, element := range elements {
+		originals[index] = *element.(*bson.Raw)
+		ids[index], _ = originals[index].Lookup("_id").ObjectIDOK()
+		if result, patchErrors, err := patch(originals[index], operations); err != nil {
+			logger.Error("An error occurred: " + err.Error())
+			return responses.InternalError(ctx)
+		} else if len(patchErrors) != 0 {
+			errors_[ids[index].Hex()] = responses.InvalidPatchElement(patchErrors)
+		} else if message := validationErrorElement(validator_.Struct(result)); message != nil {
+			errors_[ids[index].Hex()] = message
+		} else {
+			results[index] = result
+		}
+	}
+	if len(errors_) != 0 {
+		return responses.BulkInvalid(ctx, errors_)
+	}
+	for index, result := range results {
+		if ok, err := hooks.beforeUpdate(ctx, ids[index], originals[index], result); !ok {
+			return err
+		} else if message := hooks.revalidateElement(result, validator_); message != nil {
+			errors_[ids[index].Hex()] = message
+		}
+	}
+	if len(errors_) != 0 {
+		return responses.BulkInvalid(ctx, errors_)
+	}
+
+	// Store all the updated elements, unless they changed meanwhile.
+	modified := 0
+	for index, result := range results {
+		if updated, _, err := replaceOne(ctx, originals[index], result); err != nil {
+			logger.Error("An error occurred: " + err.Error())
+			errors_[ids[index].Hex()] = responses.InternalErrorElement()
+		} else if !updated {
+			errors_[ids[index].Hex()] = responses.ConcurrentModificationElement()
+		} else {
+			modified++
+			if ok, err := hooks.afterUpdate(ctx, ids[index], result); !ok {
+				return err
+			}
+		}
+	}
+	return responses.BulkUpdated(ctx, len(elements), modified, errors_)
+}
+
+// listBulkDelete is the full handler of the DELETE endpoint for list
+// resources. It deletes all the elements matching the filtering criteria
+// (up to a maximum), as long as they still match them when they are
+// deleted. In a dry run, it only tells how many elements match the
+// criteria.
+func listBulkDelete(
+	ctx echo.Context, matchMany GetManyFunc, count CountFunc, idGetter IDGetter, deleteMany DeleteManyFunc,
+	hooks *Hooks, parseFilter FilterParserFunc, parseGeo GeoParserFunc, textSearch bool, maxAffected int64,
+	logger *slog.Logger,
+) error {
+	query, dryRun, ok, err := readBulkCriteria(ctx, parseFilter, parseGeo, textSearch)
+	if !ok {
+		return err
+	}
+	if dryRun {
+		if matched, err := count(ctx, query); err != nil {
+			logger.Error("An error occurred: " + err.Error())
+			return responses.InternalError(ctx)
+		} else {
+			return responses.OkWith(ctx, echo.Map{"matched": matched})
+		}
+	}
+
+	elements, ok, err := matchBulk(ctx, matchMany, query, maxAffected, logger)
+	if !ok {
+		return err
+	}
+	ids := make([]primitive.ObjectID, len(elements))
+	for index, element := range elements {
+		ids[index] = idGetter(element)
+		if ok, err := hooks.beforeDelete(ctx, ids[index]); !ok {
+			return err
+		}
+	}
+	if len(ids) == 0 {
+		return responses.OkWith(ctx, echo.Map{"matched": 0, "deleted": 0})
+	}
+
+	deleted, err := deleteMany(ctx, ids, query)
+	if err != nil {
+		logger.Error("An error occurred: " + err.Error())
+		return responses.InternalError(ctx)
+	}
+	for _, id := range deleted {
+		if ok, err := hooks.afterDelete(ctx, id); !ok {
+			return err
+		}
+	}
+	return responses.OkWith(ctx, echo.Map{"matched": len(elements), "deleted": len(deleted)})
+}
+
+// readListCriteria reads the filtering criteria for the list-related
+// endpoints from the query string: the "filter[...]" parameters, the
+// "q" parameter (only for full-text search) and the geospatial ones.
+func readListCriteria(
+	ctx echo.Context, parseFilter FilterParserFunc, parseGeo GeoParserFunc, textSearch bool,
+) (ListQuery, bool, error) {
+	query := ListQuery{}
+	var ok bool
+	var err error
+
+	// Get the "filter[...]" query parameters
+	if query.Filter, ok, err = parseFilter(ctx); !ok {
+		return query, false, err
+	}
+
+	// Get the "q" query parameter (only for full-text search)
+	query.Search = strings.TrimSpace(ctx.QueryParam("q"))
+	if query.Search != "" && !textSearch {
+		return query, false, responses.InvalidQuery(ctx, map[string][]string{"q": {"search"}})
+	}
+
+	// Get the geospatial query parameters
+	if query.Geo, ok, err = parseGeo(ctx); !ok {
+		return query, false, err
+	} else if query.Geo != nil && query.Geo.Near && query.Search != "" {
+		return query, false, responses.InvalidQuery(ctx, map[string][]string{"q": {"near"}})
+	}
+
+	return query, true, nil
+}
+
+// listPage is the response of a list endpoint when the client
+// uses cursor-based pagination or the resource uses an envelope.
+type listPage struct {
+	Elements []any  `json:"elements"`
+	Cursor   string `json:"cursor,omitempty"`
+	Total    *int64 `json:"total,omitempty"`
+	Next     string `json:"next,omitempty"`
+	Prev     string `json:"prev,omitempty"`
+}
+
+// pageURL builds the URL of the current request, but changing
+// some of the query string parameters.
+func pageURL(ctx echo.Context, params map[string]string) string {
+	url := *ctx.Request().URL
+	query := url.Query()
+	for key, value := range params {
+		if value == "" {
+			query.Del(key)
+		} else {
+			query.Set(key, value)
+		}
+	}
+	url.RawQuery = query.Encode()
+	return url.RequestURI()
+}
+
 // listGet is the full handler of the GET endpoint for list resources.
+// The pagination is given either by the "skip" and "limit" query
+// parameters, or by the "cursor" and "limit" query parameters (an
+// empty cursor stands for the first page). If the resource has a text
+// index, the "q" query parameter performs a full-text search which,
+// unless told otherwise, is sorted by relevance. If the resource has a
+// 2dsphere index, geospatial query parameters can be used (proximity
+// queries are sorted by distance). The limit is capped to
+// the given maximum. The total count (only when a count function is
+// given) and the next / previous pages are told in the X-Total-Count
+// and Link headers and, if using an envelope, also in the body.
 func listGet(
-	ctx echo.Context, getMany GetManyFunc, defaultLimit int64, logger *slog.Logger,
+	ctx echo.Context, getMany GetManyFunc, count CountFunc, parseFilter FilterParserFunc,
+	parseSort SortParserFunc, parseFields FieldsParserFunc, parseGeo GeoParserFunc, maxLimit int64,
+	envelope, textSearch bool, logger *slog.Logger,
 ) error {
-	var skip, limit int64 = 0, defaultLimit
+	var skip, limit int64 = 0, maxLimit
 
 	// Get "skip" query parameter
 	_ = echo.QueryParamsBinder(ctx).Int64("skip", &skip).Int64("limit", &limit)
+	if skip < 0 {
+		skip = 0
+	}
+	if limit <= 0 || limit > maxLimit {
+		limit = maxLimit
+	}
+
+	// Get the filtering criteria
+	query, ok, err := readListCriteria(ctx, parseFilter, parseGeo, textSearch)
+	if !ok {
+		return err
+	}
+	query.Page, query.PageSize = skip, limit
+
+	// Get the "sort" query parameter
+	if query.Sort, ok, err = parseSort(ctx); !ok {
+		return err
+	} else if query.Sort != nil && query.Geo != nil && query.Geo.Near {
+		return responses.InvalidQuery(ctx, map[string][]string{"sort": {"near"}})
+	}
+
+	// Get the "fields" query parameter
+	if query.Fields, ok, err = parseFields(ctx); !ok {
+		return err
+	}
 
-	if result, err := getMany(ctx, skip, limit); err != nil {
+	if ctx.QueryParams().Has("cursor") {
+		query.UseCursor, query.Cursor = true, ctx.QueryParam("cursor")
+	}
+
+	result, next, err := getMany(ctx, query)
+	if errors.Is(err, errInvalidCursor) {
+		return responses.InvalidQuery(ctx, map[string][]string{"cursor": {"invalid"}})
+	} else if errors.Is(err, errCursorNotSupported) {
+		return responses.InvalidQuery(ctx, map[string][]string{"cursor": {"sort"}})
+	} else if err != nil {
 		logger.Error("An error occurred: " + err.Error())
 		return responses.InternalError(ctx)
+	}
+	page := listPage{Elements: result, Cursor: next}
+
+	// Count the elements, if enabled and supported.
+	if count != nil {
+		if total, err := count(ctx, query); err == nil {
+			page.Total = &total
+			ctx.Response().Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+		} else if !errors.Is(err, errCountNotSupported) {
+			logger.Error("An error occurred: " + err.Error())
+			return responses.InternalError(ctx)
+		}
+	}
+
+	// Tell the next / previous pages.
+	if query.UseCursor {
+		if next != "" {
+			page.Next = pageURL(ctx, map[string]string{"cursor": next})
+		}
+	} else {
+		limitStr := strconv.FormatInt(limit, 10)
+		if page.Total != nil && (skip+1)*limit < *page.Total || page.Total == nil && int64(len(result)) == limit {
+			page.Next = pageURL(ctx, map[string]string{"skip": strconv.FormatInt(skip+1, 10), "limit": limitStr})
+		}
+		if skip > 0 {
+			page.Prev = pageURL(ctx, map[string]string{"skip": strconv.FormatInt(skip-1, 10), "limit": limitStr})
+		}
+	}
+	var links []string
+	if page.Next != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, page.Next))
+	}
+	if page.Prev != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, page.Prev))
+	}
+	if len(links) != 0 {
+		ctx.Response().Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	if query.UseCursor || envelope {
+		return responses.OkWith(ctx, page)
 	} else {
 		return responses.OkWith(ctx, result)
 	}
 }
 
+// listCount is the full handler of the HEAD and GET ~count endpoints
+// for list resources. It counts the elements matching the filtering
+// criteria, telling the count in the X-Total-Count header and, unless
+// it is a HEAD request, also in the body.
+func listCount(
+	ctx echo.Context, count CountFunc, parseFilter FilterParserFunc, parseGeo GeoParserFunc, textSearch bool,
+	logger *slog.Logger,
+) error {
+	query, ok, err := readListCriteria(ctx, parseFilter, parseGeo, textSearch)
+	if !ok {
+		return err
+	}
+
+	if total, err := count(ctx, query); errors.Is(err, errCountNotSupported) {
+		return responses.InvalidQuery(ctx, map[string][]string{"near": {"count"}})
+	} else if err != nil {
+		logger.Error("An error occurred: " + err.Error())
+		return responses.InternalError(ctx)
+	} else {
+		ctx.Response().Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+		if ctx.Request().Method == http.MethodHead {
+			return ctx.NoContent(http.StatusOK)
+		}
+		return responses.OkWith(ctx, echo.Map{"count": total})
+	}
+}
+
+// listDistinct is the full handler of the GET ~distinct endpoint for
+// list resources. It returns the distinct values of a field (among the
+// allowed ones) in the elements matching the filtering criteria.
+func listDistinct(
+	ctx echo.Context, distinct DistinctFunc, allowed []string, parseFilter FilterParserFunc,
+	parseGeo GeoParserFunc, textSearch bool, logger *slog.Logger,
+) error {
+	field := ctx.Param("field")
+	if !slices.Contains(allowed, field) {
+		return responses.NotFound(ctx)
+	}
+
+	query, ok, err := readListCriteria(ctx, parseFilter, parseGeo, textSearch)
+	if !ok {
+		return err
+	}
+
+	if values, err := distinct(ctx, field, query); errors.Is(err, errCountNotSupported) {
+		return responses.InvalidQuery(ctx, map[string][]string{"near": {"distinct"}})
+	} else if err != nil {
+		logger.Error("An error occurred: " + err.Error())
+		return responses.InternalError(ctx)
+	} else {
+		return responses.OkWith(ctx, values)
+	}
+}
+
+// listStats is the full handler of the GET ~stats endpoint for list
+// resources. It computes the statistics of the elements matching the
+// filtering criteria, grouped by the client-provided fields.
+func listStats(
+	ctx echo.Context, stats StatsFunc, parseStats StatsParserFunc, parseFilter FilterParserFunc,
+	parseGeo GeoParserFunc, textSearch bool, logger *slog.Logger,
+) error {
+	query, ok, err := readListCriteria(ctx, parseFilter, parseGeo, textSearch)
+	if !ok {
+		return err
+	}
+
+	statsQuery, ok, err := parseStats(ctx)
+	if !ok {
+		return err
+	}
+
+	if results, err := stats(ctx, query, statsQuery); errors.Is(err, errCountNotSupported) {
+		return responses.InvalidQuery(ctx, map[string][]string{"near": {"stats"}})
+	} else if errors.Is(err, errTooManyGroups) {
+		return responses.InvalidQuery(ctx, map[string][]string{"group_by": {"too-many-groups"}})
+	} else if err != nil {
+		logger.Error("An error occurred: " + err.Error())
+		return responses.InternalError(ctx)
+	} else {
+		return responses.OkWith(ctx, results)
+	}
+}
+
 // listItemGet is the full handler of the GET endpoint for list item resources.
 func listItemGet(
-	ctx echo.Context, getOne GetOneFunc, id primitive.ObjectID, logger *slog.Logger,
+	ctx echo.Context, getOne GetOneFunc, parseFields FieldsParserFunc, id primitive.ObjectID, logger *slog.Logger,
 ) error {
-	if element, err := getOne(ctx, id); err == nil {
-		return responses.OkWith(ctx, element)
+	fields, ok, err := parseFields(ctx)
+	if !ok {
+		return err
+	}
+
+	if element, meta, err := getOne(ctx, id, fields...); err == nil {
+		return okWithElement(ctx, element, meta, logger)
 	} else {
 		return responses.FindOneOperationError(ctx, err, logger)
 	}
@@ -182,47 +917,61 @@ func listItemGet(
 
 // listItemUpdate is the full handler of the PATCH endpoint for the list item resources.
 func listItemUpdate(
-	ctx echo.Context, getOne GetOneFunc, idSetter IDSetter, replaceOne ReplaceOneFunc, makeMap func() any,
-	id primitive.ObjectID, simulatedUpdate SimulatedUpdateFunc, validatorMaker func() *validator.Validate,
-	logger *slog.Logger,
+	ctx echo.Context, getRaw GetRawFunc, patch PatchFunc, replaceOne GuardedReplaceOneFunc, idSetter IDSetter,
+	readIfMatch IfMatchReaderFunc, hooks *Hooks, output OutputFunc, makeMap func() any, checkPolicy PatchPolicyFunc,
+	id primitive.ObjectID, validatorMaker func() *validator.Validate, logger *slog.Logger,
 ) error {
-	if element, err := getOne(ctx, id); err == nil {
-		if updates, success, err := readJSONBody(ctx, makeMap, nil); success {
-			if result, err := simulatedUpdate(ctx, id, element, updates); err != nil {
-				logger.Error("An error occurred: " + err.Error())
-				return responses.InternalError(ctx)
-			} else if valid, err := validate(ctx, result, validatorMaker()); !valid {
-				return err
-			} else if updated, err := replaceOne(ctx, id, result); err != nil {
-				logger.Error("An error occurred: " + err.Error())
-				return responses.InternalError(ctx)
-			} else if updated {
-				idSetter(result, id)
-				return responses.OkWith(ctx, result)
-			} else {
-				return responses.NotFound(ctx)
-			}
-		} else {
-			return err
-		}
+	if versions, ok, err := readIfMatch(ctx); !ok {
+		return err
+	} else if operations, ok, err := readPatch(ctx, makeMap, checkPolicy); !ok {
+		return err
 	} else {
-		return responses.FindOneOperationError(ctx, err, logger)
+		return patchOne(
+			ctx, getRaw, patch, replaceOne, idSetter, hooks, output, id, versions, operations, validatorMaker, logger,
+		)
 	}
 }
 
 // listItemReplace is the full handler of the PUT endpoint for the list item resources.
+// If upserting is allowed, the element is created (201) when it does not exist, unless
+// the client expects a particular version of it.
 func listItemReplace(
-	ctx echo.Context, replaceOne ReplaceOneFunc, make_ func() any, id primitive.ObjectID,
+	ctx echo.Context, replaceOne ReplaceOneFunc, upsertOne UpsertOneFunc, getOne GetOneFunc,
+	readIfMatch IfMatchReaderFunc, hooks *Hooks, makeBody func() any, input InputFunc, id primitive.ObjectID,
 	validatorMaker func() *validator.Validate, logger *slog.Logger,
 ) error {
-	if replacement, ok, err := readJSONBody(ctx, make_, validatorMaker()); ok {
-		if ok, err := replaceOne(ctx, id, replacement); err != nil {
+	if upsertOne == nil || ctx.Request().Header.Get("If-Match") != "" {
+		return replaceItem(
+			ctx, replaceOne, getOne, readIfMatch, hooks, makeBody, input, id, validatorMaker, logger,
+		)
+	}
+	if _, ok, err := readIfMatch(ctx); !ok {
+		return err
+	}
+
+	if replacement, ok, err := readInput(ctx, makeBody, input, validatorMaker(), logger); ok {
+		if ok, err := hooks.beforeReplace(ctx, id, replacement); !ok {
+			return err
+		} else if ok, err := hooks.revalidate(ctx, replacement, validatorMaker()); !ok {
+			return err
+		}
+		if created, meta, err := upsertOne(ctx, id, replacement); err == nil {
+			if created {
+				if ok, err := hooks.afterCreate(ctx, id, replacement); !ok {
+					return err
+				}
+				setETag(ctx, meta)
+				return responses.Created(ctx, id)
+			} else if ok, err := hooks.afterUpdate(ctx, id, replacement); !ok {
+				return err
+			}
+			setETag(ctx, meta)
+			return responses.Ok(ctx)
+		} else if mongo.IsDuplicateKeyError(err) {
+			return responses.DuplicateKey(ctx)
+		} else {
 			logger.Error("An error occurred: " + err.Error())
 			return responses.InternalError(ctx)
-		} else if !ok {
-			return responses.NotFound(ctx)
-		} else {
-			return responses.Ok(ctx)
 		}
 	} else {
 		return err
@@ -231,14 +980,126 @@ func listItemReplace(
 
 // listItemDelete is the full  handler of the DELETE endpoint for the list item resources.
 func listItemDelete(
-	ctx echo.Context, deleteOne DeleteOneFunc, id primitive.ObjectID, logger *slog.Logger,
+	ctx echo.Context, deleteOne DeleteOneFunc, getOne GetOneFunc, readIfMatch IfMatchReaderFunc, hooks *Hooks,
+	id primitive.ObjectID, logger *slog.Logger,
+) error {
+	return deleteItem(ctx, deleteOne, getOne, readIfMatch, hooks, id, logger)
+}
+
+// listItemRestore is the full handler of the POST ~restore endpoint for the list item
+// resources. It restores a soft-deleted element.
+func listItemRestore(
+	ctx echo.Context, restoreOne RestoreOneFunc, id primitive.ObjectID, logger *slog.Logger,
 ) error {
-	if deleted, err := deleteOne(ctx, id); err != nil {
+	if restored, err := restoreOne(ctx, id); err == nil {
+		if !restored {
+			return responses.NotFound(ctx)
+		}
+		return responses.Ok(ctx)
+	} else if mongo.IsDuplicateKeyError(err) {
+		return responses.DuplicateKey(ctx)
+	} else {
+		logger.Error("An error occurred: " + err.Error())
+		return responses.InternalError(ctx)
+	}
+}
+
+// listItemRevisions is the full handler of the GET ~revisions endpoint for the list
+// item resources. It lists the revisions of an element, the latest first, paginated
+// by the "skip" and "limit" query parameters (as in listGet).
+func listItemRevisions(
+	ctx echo.Context, getRevisions GetRevisionsFunc, id primitive.ObjectID, maxLimit int64, logger *slog.Logger,
+) error {
+	var skip, limit int64 = 0, maxLimit
+	_ = echo.QueryParamsBinder(ctx).Int64("skip", &skip).Int64("limit", &limit)
+	if skip < 0 {
+		skip = 0
+	}
+	if limit <= 0 || limit > maxLimit {
+		limit = maxLimit
+	}
+
+	if records, err := getRevisions(ctx, id, skip, limit); err != nil {
+		logger.Error("An error occurred: " + err.Error())
+		return responses.InternalError(ctx)
+	} else {
+		revisions := make([]echo.Map, len(records))
+		for index, record := range records {
+			revisions[index] = record.summary()
+		}
+		return responses.OkWith(ctx, revisions)
+	}
+}
+
+// readRevision gets the revision of an element told by the :revision
+// parameter, with its document decoded as an element.
+func readRevision(
+	ctx echo.Context, getRevision GetRevisionFunc, make_ func() any, id primitive.ObjectID, logger *slog.Logger,
+) (revisionRecord, any, bool, error) {
+	revision, err := strconv.ParseInt(ctx.Param("revision"), 10, 64)
+	if err != nil {
+		return revisionRecord{}, nil, false, responses.NotFound(ctx)
+	}
+
+	element := make_()
+	if record, err := getRevision(ctx, id, revision); err != nil {
+		return record, nil, false, responses.FindOneOperationError(ctx, err, logger)
+	} else if err := bson.Unmarshal(record.Document, element); err != nil {
+		logger.Error("An error occurred: " + err.Error())
+		return record, nil, false, responses.InternalError(ctx)
+	} else {
+		return record, element, true, nil
+	}
+}
+
+// listItemRevision is the full handler of the GET ~revisions/:revision endpoint for
+// the list item resources. It gets a revision of an element, with its document.
+func listItemRevision(
+	ctx echo.Context, getRevision GetRevisionFunc, make_ func() any, output OutputFunc, id primitive.ObjectID,
+	logger *slog.Logger,
+) error {
+	if record, element, ok, err := readRevision(ctx, getRevision, make_, id, logger); !ok {
+		return err
+	} else if rendered, err := render(output, element); err != nil {
 		logger.Error("An error occurred: " + err.Error())
 		return responses.InternalError(ctx)
-	} else if !deleted {
-		return responses.NotFound(ctx)
 	} else {
+		revision := record.summary()
+		revision["document"] = rendered
+		return responses.OkWith(ctx, revision)
+	}
+}
+
+// listItemRollback is the full handler of the POST ~revisions/:revision/~rollback
+// endpoint for the list item resources. It replaces an element with the document
+// of one of its revisions, which must still be valid, honouring the If-Match header.
+func listItemRollback(
+	ctx echo.Context, getRevision GetRevisionFunc, replaceOne ReplaceOneFunc, getOne GetOneFunc,
+	readIfMatch IfMatchReaderFunc, hooks *Hooks, make_ func() any, id primitive.ObjectID,
+	validatorMaker func() *validator.Validate, logger *slog.Logger,
+) error {
+	versions, ok, err := readIfMatch(ctx)
+	if !ok {
+		return err
+	}
+
+	if _, element, ok, err := readRevision(ctx, getRevision, make_, id, logger); !ok {
+		return err
+	} else if valid, err := validate(ctx, element, validatorMaker()); !valid {
+		return err
+	} else if ok, err := hooks.beforeReplace(ctx, id, element); !ok {
+		return err
+	} else if ok, err := hooks.revalidate(ctx, element, validatorMaker()); !ok {
+		return err
+	} else if ok, meta, err := replaceOne(ctx, id, element, versions); err != nil {
+		logger.Error("An error occurred: " + err.Error())
+		return responses.InternalError(ctx)
+	} else if !ok {
+		return notMatched(ctx, getOne, id, versions, logger)
+	} else if ok, err := hooks.afterUpdate(ctx, id, element); !ok {
+		return err
+	} else {
+		setETag(ctx, meta)
 		return responses.Ok(ctx)
 	}
 }
@@ -263,16 +1124,22 @@ func resourceMethod(
 			}
 		}()
 		logger.Debug(
-			"Invoking custom method: (type=%v name=%s) on resource: %s", methodType, method, resourceKey,
+			"Invoking custom method", "type", methodType, "name", method, "resource", resourceKey,
 		)
 		return resourceMethod.Handler(ctx, client, resourceKey, method, collection, validatorMaker, filter)
 	}
 }
 
-// itemMethod is the full handler of a resource method.
+// itemMethod is the full handler of a resource method. In versioned
+// resources, operation methods increment the version of the element
+// before running, honouring the If-Match header in the same atomic
+// write, and the handler gets the filter restricted to the new version
+// (so its writes do not apply if the element changes meanwhile, as long
+// as they use that filter). The new version is told in the ETag header.
 func itemMethod(
 	ctx echo.Context, collection *mongo.Collection, filter bson.M, resourceKey string, methodType dsl.MethodType,
 	id primitive.ObjectID, method string, methods map[string]dsl.ItemMethod, client *mongo.Client,
+	getOne GetOneFunc, readIfMatch IfMatchReaderFunc, bumpVersion BumpVersionFunc,
 	validatorMaker func() *validator.Validate, logger *slog.Logger,
 ) (err error) {
 	if !strings.HasPrefix(method, "~") {
@@ -282,6 +1149,24 @@ func itemMethod(
 	if itemMethod, ok := methods[method]; !ok || itemMethod.Handler == nil || itemMethod.Type != methodType {
 		return responses.NotFound(ctx)
 	} else {
+		if methodType == dsl.Operation && bumpVersion != nil {
+			if versions, ok, err := readIfMatch(ctx); !ok {
+				return err
+			} else if meta, found, err := bumpVersion(ctx, id, versions); err != nil {
+				logger.Error("An error occurred: " + err.Error())
+				return responses.InternalError(ctx)
+			} else if !found && versions == nil {
+				return responses.NotFound(ctx)
+			} else if !found {
+				if _, _, err := getOne(ctx, id, "_id"); err != nil {
+					return responses.FindOneOperationError(ctx, err, logger)
+				}
+				return responses.PreconditionFailed(ctx)
+			} else {
+				filter = withVersions(filter, []int64{meta.Version})
+				setETag(ctx, meta)
+			}
+		}
 		defer func() {
 			if v := recover(); v != nil {
 				logger.Error("An error occurred (it was panicked): " + err.Error())
@@ -289,7 +1174,7 @@ func itemMethod(
 			}
 		}()
 		logger.Debug(
-			"Invoking custom item method: (type=%v name=%s) on resource: %s", methodType, method, resourceKey,
+			"Invoking custom item method", "type", methodType, "name", method, "resource", resourceKey,
 		)
 		return itemMethod.Handler(ctx, client, resourceKey, method, collection, validatorMaker, filter, id)
 	}
@@ -0,0 +1,210 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// noFilter, noSort, noFields and noGeo are query string parsers that
+// never tell criteria.
+func noFilter(echo.Context) (bson.M, bool, error)   { return nil, true, nil }
+func noSort(echo.Context) (bson.D, bool, error)     { return nil, true, nil }
+func noFields(echo.Context) ([]string, bool, error) { return nil, true, nil }
+func noGeo(echo.Context) (*GeoQuery, bool, error)   { return nil, true, nil }
+
+func TestListGetPagination(t *testing.T) {
+	cases := []struct {
+		name     string
+		query    string
+		total    int64
+		counted  bool
+		size     int
+		envelope bool
+		page     int64
+		pageSize int64
+		link     string
+	}{
+		{"uses the maximum by default", "", 0, false, 2, false, 0, 10, ""},
+		{"caps the limit", "limit=50", 0, false, 2, false, 0, 10, ""},
+		{"ignores non-positive limits", "limit=0&skip=-1", 0, false, 2, false, 0, 10, ""},
+		{"honors smaller limits", "limit=2&skip=1", 0, false, 1, false, 1, 2, `</?limit=2&skip=0>; rel="prev"`},
+		{
+			"guesses a next page from a full page", "limit=2", 0, false, 2, false, 0, 2,
+			`</?limit=2&skip=1>; rel="next"`,
+		},
+		{
+			"tells the next page from the total", "limit=2&skip=1", 7, true, 2, true, 1, 2,
+			`</?limit=2&skip=2>; rel="next", </?limit=2&skip=0>; rel="prev"`,
+		},
+		{"tells no next page after the total", "limit=2&skip=3", 7, true, 1, true, 3, 2, `</?limit=2&skip=2>; rel="prev"`},
+		{"follows cursors", "cursor=&limit=2", 0, false, 2, false, 0, 2, `</?cursor=next&limit=2>; rel="next"`},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			var query ListQuery
+			getMany := func(ctx echo.Context, query_ ListQuery) ([]any, string, error) {
+				query = query_
+				next := ""
+				if query_.UseCursor {
+					next = "next"
+				}
+				return make([]any, case_.size), next, nil
+			}
+			var count CountFunc
+			if case_.counted {
+				count = func(echo.Context, ListQuery) (int64, error) { return case_.total, nil }
+			}
+			ctx, recorder := newTestContext(http.MethodGet, "/?"+case_.query, nil)
+			if err := listGet(
+				ctx, getMany, count, noFilter, noSort, noFields, noGeo, 10, case_.envelope, false, slog.Default(),
+			); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if recorder.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", recorder.Code)
+			} else if query.Page != case_.page || query.PageSize != case_.pageSize {
+				t.Fatalf("expected page %d of size %d, got %d of size %d", case_.page, case_.pageSize, query.Page, query.PageSize)
+			} else if link := recorder.Header().Get("Link"); link != case_.link {
+				t.Fatalf("expected the link %q, got %q", case_.link, link)
+			}
+
+			if case_.counted {
+				if total := recorder.Header().Get("X-Total-Count"); total != "7" {
+					t.Fatalf("expected the total count 7, got %q", total)
+				}
+			}
+			if case_.envelope || query.UseCursor {
+				var page listPage
+				if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				} else if len(page.Elements) != case_.size {
+					t.Fatalf("expected %d elements, got %d", case_.size, len(page.Elements))
+				} else if case_.counted && (page.Total == nil || *page.Total != case_.total) {
+					t.Fatalf("expected the total %d in the body, got %v", case_.total, page.Total)
+				}
+			} else {
+				var elements []any
+				if err := json.Unmarshal(recorder.Body.Bytes(), &elements); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				} else if len(elements) != case_.size {
+					t.Fatalf("expected %d elements, got %d", case_.size, len(elements))
+				}
+			}
+		})
+	}
+}
+
+func TestReadListCriteria(t *testing.T) {
+	cases := []struct {
+		name       string
+		query      string
+		textSearch bool
+		search     string
+		errors     map[string][]string
+	}{
+		{"tells no search", "q=%20", false, "", nil},
+		{"trims the search", "q=%20x%20y%20", true, "x y", nil},
+		{"rejects searching without a text index", "q=x", false, "", map[string][]string{"q": {"search"}}},
+		{"rejects searching by proximity", "q=x&near=1,2", true, "", map[string][]string{"q": {"near"}}},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			ctx, recorder := newTestContext(http.MethodGet, "/?"+case_.query, nil)
+			query, ok, err := readListCriteria(ctx, noFilter, makeGeoParser([]string{"where"}), case_.textSearch)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if case_.errors != nil {
+				if ok {
+					t.Fatalf("expected errors %v, got the query %v", case_.errors, query)
+				} else if errors := responseErrors(t, recorder); !reflect.DeepEqual(errors, case_.errors) {
+					t.Fatalf("expected errors %v, got %v", case_.errors, errors)
+				}
+			} else if !ok {
+				t.Fatalf("unexpected errors: %s", recorder.Body.String())
+			} else if query.Search != case_.search {
+				t.Fatalf("expected the search %q, got %q", case_.search, query.Search)
+			}
+		})
+	}
+}
+
+func TestListCount(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		err    error
+		status int
+		body   string
+	}{
+		{"tells the count", http.MethodGet, nil, http.StatusOK, `{"count":7}`},
+		{"tells only the header on HEAD", http.MethodHead, nil, http.StatusOK, ""},
+		{
+			"rejects unsupported criteria", http.MethodGet, errCountNotSupported, http.StatusBadRequest,
+			`{"code":"query:invalid","errors":{"near":["count"]}}`,
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			count := func(echo.Context, ListQuery) (int64, error) { return 7, case_.err }
+			ctx, recorder := newTestContext(case_.method, "/", nil)
+			if err := listCount(ctx, count, noFilter, noGeo, false, slog.Default()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if recorder.Code != case_.status {
+				t.Fatalf("expected status %d, got %d", case_.status, recorder.Code)
+			} else if body := strings.TrimSpace(recorder.Body.String()); body != case_.body {
+				t.Fatalf("expected the body %s, got %s", case_.body, body)
+			} else if total := recorder.Header().Get("X-Total-Count"); case_.err == nil && total != "7" {
+				t.Fatalf("expected the total count 7, got %q", total)
+			}
+		})
+	}
+}
+
+func TestListDistinct(t *testing.T) {
+	cases := []struct {
+		name   string
+		field  string
+		err    error
+		status int
+		body   string
+	}{
+		{"tells the values", "name", nil, http.StatusOK, `["x","y"]`},
+		{"hides other fields", "age", nil, http.StatusNotFound, `{"code":"not-found"}`},
+		{
+			"rejects unsupported criteria", "name", errCountNotSupported, http.StatusBadRequest,
+			`{"code":"query:invalid","errors":{"near":["distinct"]}}`,
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			var field string
+			distinct := func(ctx echo.Context, field_ string, query ListQuery) ([]any, error) {
+				field = field_
+				return []any{"x", "y"}, case_.err
+			}
+			ctx, recorder := newTestContext(http.MethodGet, "/", nil)
+			ctx.SetParamNames("field")
+			ctx.SetParamValues(case_.field)
+			if err := listDistinct(
+				ctx, distinct, []string{"name"}, noFilter, noGeo, false, slog.Default(),
+			); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if recorder.Code != case_.status {
+				t.Fatalf("expected status %d, got %d", case_.status, recorder.Code)
+			} else if body := strings.TrimSpace(recorder.Body.String()); body != case_.body {
+				t.Fatalf("expected the body %s, got %s", case_.body, body)
+			} else if case_.status != http.StatusNotFound && field != case_.field {
+				t.Fatalf("expected the field %s, got %s", case_.field, field)
+			}
+		})
+	}
+}
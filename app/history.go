@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/formats"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log/slog"
+	"time"
+)
+
+const (
+	// historySuffix is the suffix of the name of the companion
+	// collection holding the revisions of the elements, in
+	// resources with history.
+	historySuffix = "_history"
+
+	// revisionField is the field holding the number of revisions
+	// recorded for an element, in resources with history. Each write
+	// recording a revision increments it atomically, so the number of
+	// the revision is fixed by the write itself.
+	revisionField = "_revision"
+)
+
+// revisionRecord is a prior version of an element, stored when the
+// element is replaced, updated, deleted or restored. Revisions are
+// numbered from 1, for each element, in the order of the writes.
+type revisionRecord struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	Element  primitive.ObjectID `bson:"element"`
+	Revision int64              `bson:"revision"`
+	At       time.Time          `bson:"at"`
+	ApiKey   primitive.ObjectID `bson:"api_key"`
+	Document bson.Raw           `bson:"document,omitempty"`
+}
+
+// summary renders a revision, without its document.
+func (record revisionRecord) summary() echo.Map {
+	return echo.Map{
+		"revision": record.Revision,
+		"at":       formats.DateTime(primitive.NewDateTimeFromTime(record.At)),
+		"api_key":  record.ApiKey,
+	}
+}
+
+// RecordRevisionFunc stands for a function that stores the prior
+// version of an element, once the write that replaced it is done.
+type RecordRevisionFunc func(echo.Context, bson.Raw)
+
+// LatestRevisionFunc stands for a function that gets the number of
+// the latest recorded revision of an element, or 0 if there is none.
+type LatestRevisionFunc func(echo.Context, primitive.ObjectID) (int64, error)
+
+// GetRevisionsFunc stands for a function that gets the revisions of
+// an element (without their documents), the latest first, given the
+// page and the page size.
+type GetRevisionsFunc func(echo.Context, primitive.ObjectID, int64, int64) ([]revisionRecord, error)
+
+// GetRevisionFunc stands for a function that gets a revision of an
+// element, given its number.
+type GetRevisionFunc func(echo.Context, primitive.ObjectID, int64) (revisionRecord, error)
+
+// historyCollection returns the companion collection holding the
+// revisions of the elements of a resource.
+func historyCollection(client *mongo.Client, resource *dsl.Resource) *mongo.Collection {
+	return client.Database(resource.Db).Collection(resource.Collection + historySuffix)
+}
+
+// revisionOf returns the number the prior version of an element gets
+// when recorded: the revisions it already had, plus 1.
+func revisionOf(previous bson.Raw) int64 {
+	revision, _ := previous.Lookup(revisionField).AsInt64OK()
+	return revision + 1
+}
+
+// makeRecordRevision makes a function that stores the prior version
+// of an element, telling when it was changed and the API key that
+// changed it. Since the write already happened, the record is stored
+// even if the client disconnects, and a failure is only logged.
+func makeRecordRevision(collection *mongo.Collection, logger *slog.Logger) RecordRevisionFunc {
+	return func(ctx echo.Context, previous bson.Raw) {
+		id, ok := previous.Lookup("_id").ObjectIDOK()
+		if !ok {
+			logger.Error("An error occurred: the changed element has no id")
+			return
+		}
+
+		record := revisionRecord{
+			Element: id, Revision: revisionOf(previous), At: now(), ApiKey: actorOf(ctx), Document: previous,
+		}
+		if _, err := collection.InsertOne(
+			context.WithoutCancel(ctx.Request().Context()), record,
+		); err != nil {
+			logger.Error("An error occurred: " + err.Error())
+		}
+	}
+}
+
+// makeLatestRevision makes a function that gets the number of the
+// latest recorded revision of an element.
+func makeLatestRevision(collection *mongo.Collection) LatestRevisionFunc {
+	return func(ctx echo.Context, id primitive.ObjectID) (int64, error) {
+		latest := revisionRecord{}
+		if err := collection.FindOne(
+			ctx.Request().Context(), bson.M{"element": id},
+			options.FindOne().SetSort(bson.D{{Key: "revision", Value: -1}}).SetProjection(bson.M{"revision": 1}),
+		).Decode(&latest); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, err
+		}
+		return latest.Revision, nil
+	}
+}
+
+// makeGetRevisions makes a function that gets the revisions of an
+// element, the latest first.
+func makeGetRevisions(collection *mongo.Collection) GetRevisionsFunc {
+	return func(ctx echo.Context, id primitive.ObjectID, page, pageSize int64) ([]revisionRecord, error) {
+		options_ := options.Find().
+			SetSort(bson.D{{Key: "revision", Value: -1}}).
+			SetSkip(page * pageSize).
+			SetLimit(pageSize).
+			SetProjection(bson.M{"document": 0})
+		if cursor, err := collection.Find(ctx.Request().Context(), bson.M{"element": id}, options_); err != nil {
+			return nil, err
+		} else {
+			records := []revisionRecord{}
+			if err := cursor.All(ctx.Request().Context(), &records); err != nil {
+				return nil, err
+			}
+			return records, nil
+		}
+	}
+}
+
+// makeGetRevision makes a function that gets a revision of an element.
+func makeGetRevision(collection *mongo.Collection) GetRevisionFunc {
+	return func(ctx echo.Context, id primitive.ObjectID, revision int64) (revisionRecord, error) {
+		record := revisionRecord{}
+		err := collection.FindOne(
+			ctx.Request().Context(), bson.M{"element": id, "revision": revision},
+		).Decode(&record)
+		return record, err
+	}
+}
@@ -0,0 +1,143 @@
+package app
+
+import (
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/formats"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRevisionOf(t *testing.T) {
+	cases := []struct {
+		name     string
+		previous bson.D
+		expected int64
+	}{
+		{"starts at 1", bson.D{{Key: "a", Value: 1}}, 1},
+		{"follows 32-bit revisions", bson.D{{Key: revisionField, Value: int32(2)}}, 3},
+		{"follows 64-bit revisions", bson.D{{Key: revisionField, Value: int64(5)}}, 6},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			previous, _ := bson.Marshal(case_.previous)
+			if revision := revisionOf(previous); revision != case_.expected {
+				t.Fatalf("expected %d, got %d", case_.expected, revision)
+			}
+		})
+	}
+}
+
+func TestRevisionSummary(t *testing.T) {
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	apiKey := primitive.NewObjectID()
+	record := revisionRecord{Revision: 2, At: at, ApiKey: apiKey, Document: bson.Raw{}}
+	expected := echo.Map{
+		"revision": int64(2), "at": formats.DateTime(primitive.NewDateTimeFromTime(at)), "api_key": apiKey,
+	}
+	if summary := record.summary(); !reflect.DeepEqual(summary, expected) {
+		t.Fatalf("expected %v, got %v", expected, summary)
+	}
+}
+
+func TestTrackingIncrements(t *testing.T) {
+	revisions := func(echo.Context, bson.Raw) {}
+	cases := []struct {
+		name      string
+		tracking  Tracking
+		expected  bson.M
+		pipelined bool
+	}{
+		{"increments nothing", Tracking{}, bson.M{}, false},
+		{"increments the version", Tracking{Versioned: true}, bson.M{versionField: 1}, true},
+		{"increments the revision", Tracking{Revisions: revisions}, bson.M{revisionField: 1}, true},
+		{
+			"increments both", Tracking{Versioned: true, Revisions: revisions},
+			bson.M{versionField: 1, revisionField: 1}, true,
+		},
+		{"keeps the read-only fields", Tracking{ReadOnly: []string{"a"}}, bson.M{}, true},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if increments := case_.tracking.increments(); !reflect.DeepEqual(increments, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, increments)
+			} else if pipelined := case_.tracking.pipelined(); pipelined != case_.pipelined {
+				t.Fatalf("expected pipelined to be %v, got %v", case_.pipelined, pipelined)
+			}
+		})
+	}
+}
+
+// revisionModel is the model type used to test the rollbacks.
+type revisionModel struct {
+	Name string `bson:"name" validate:"required"`
+}
+
+func TestListItemRollback(t *testing.T) {
+	cases := []struct {
+		name     string
+		revision string
+		document bson.D
+		header   string
+		replaced bool
+		status   int
+	}{
+		{"rolls back", "1", bson.D{{Key: "name", Value: "x"}}, `"2"`, true, http.StatusOK},
+		{"tells invalid revisions", "x", nil, "", false, http.StatusNotFound},
+		{"tells missing revisions", "2", nil, "", false, http.StatusNotFound},
+		{"rejects invalid documents", "1", bson.D{{Key: "name", Value: ""}}, "", false, http.StatusBadRequest},
+		{"rejects other versions", "1", bson.D{{Key: "name", Value: "x"}}, `"1"`, false, http.StatusPreconditionFailed},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			getRevision := func(ctx echo.Context, id primitive.ObjectID, revision int64) (revisionRecord, error) {
+				if revision != 1 {
+					return revisionRecord{}, mongo.ErrNoDocuments
+				}
+				document, _ := bson.Marshal(case_.document)
+				return revisionRecord{Revision: 1, Document: document}, nil
+			}
+			var replaced any
+			replaceOne := func(
+				ctx echo.Context, id primitive.ObjectID, element any, versions []int64,
+			) (bool, ElementMeta, error) {
+				if !reflect.DeepEqual(versions, []int64{2}) {
+					return false, ElementMeta{}, nil
+				}
+				replaced = element
+				return true, ElementMeta{Version: 3}, nil
+			}
+			getOne := func(echo.Context, primitive.ObjectID, ...string) (any, ElementMeta, error) {
+				return &revisionModel{}, ElementMeta{Version: 2}, nil
+			}
+			header := map[string]string{}
+			if case_.header != "" {
+				header["If-Match"] = case_.header
+			}
+			ctx, recorder := newTestContext(http.MethodPost, "/", header)
+			ctx.SetParamNames("revision")
+			ctx.SetParamValues(case_.revision)
+			if err := listItemRollback(
+				ctx, getRevision, replaceOne, getOne, makeIfMatchReader(true, false), nil,
+				func() any { return &revisionModel{} }, primitive.NewObjectID(), validator.New, slog.Default(),
+			); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if recorder.Code != case_.status {
+				t.Fatalf("expected status %d, got %d: %s", case_.status, recorder.Code, recorder.Body.String())
+			} else if (replaced != nil) != case_.replaced {
+				t.Fatalf("expected the element to be replaced: %v, got %v", case_.replaced, replaced)
+			} else if case_.replaced && recorder.Header().Get("ETag") != `"3"` {
+				t.Fatalf("expected the tag \"3\", got %s", recorder.Header().Get("ETag"))
+			}
+		})
+	}
+}
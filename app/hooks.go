@@ -0,0 +1,145 @@
+package app
+
+import (
+	"errors"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/responses"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log/slog"
+)
+
+// Hooks runs the lifecycle hooks of a resource. Each of its methods
+// tells whether the request can go on and, otherwise, renders the
+// response of the aborted request. A nil *Hooks runs no hook.
+type Hooks struct {
+	hooks      dsl.Hooks
+	collection *mongo.Collection
+	make_      func() any
+	logger     *slog.Logger
+}
+
+// makeHooks makes the runner of the lifecycle hooks of a resource.
+// It returns nil if the resource has no hooks.
+func makeHooks(hooks *dsl.Hooks, collection *mongo.Collection, make_ func() any, logger *slog.Logger) *Hooks {
+	if hooks == nil {
+		return nil
+	}
+	return &Hooks{hooks: *hooks, collection: collection, make_: make_, logger: logger}
+}
+
+// abort renders the response of a hook that failed (unless the hook
+// rendered it by itself), and tells whether the request can go on.
+func (hooks *Hooks) abort(ctx echo.Context, err error) (bool, error) {
+	var abort *responses.Error
+	if ctx.Response().Committed {
+		if err != nil {
+			hooks.logger.Error("An error occurred: " + err.Error())
+		}
+		return false, nil
+	} else if err == nil {
+		return true, nil
+	} else if errors.As(err, &abort) {
+		return false, abort.Render(ctx)
+	} else {
+		hooks.logger.Error("An error occurred: " + err.Error())
+		return false, responses.InternalError(ctx)
+	}
+}
+
+// revalidate validates an element again after the Before* hooks ran
+// on it, since they may have changed it. On errors, it renders the
+// response. Without hooks, there is nothing to do.
+func (hooks *Hooks) revalidate(ctx echo.Context, element any, validator_ *validator.Validate) (bool, error) {
+	if hooks == nil {
+		return true, nil
+	}
+	return validate(ctx, element, validator_)
+}
+
+// revalidateElement validates again one of many elements after the
+// Before* hooks ran on it. It returns the error message of the element
+// (nil if it is valid).
+func (hooks *Hooks) revalidateElement(element any, validator_ *validator.Validate) echo.Map {
+	if hooks == nil {
+		return nil
+	}
+	return validationErrorElement(validator_.Struct(element))
+}
+
+// beforeCreate runs the BeforeCreate hook.
+func (hooks *Hooks) beforeCreate(ctx echo.Context, element any) (bool, error) {
+	if hooks == nil || hooks.hooks.BeforeCreate == nil {
+		return true, nil
+	}
+	return hooks.abort(ctx, hooks.hooks.BeforeCreate(ctx, authToken(ctx), hooks.collection, element))
+}
+
+// afterCreate runs the AfterCreate hook.
+func (hooks *Hooks) afterCreate(ctx echo.Context, id primitive.ObjectID, element any) (bool, error) {
+	if hooks == nil || hooks.hooks.AfterCreate == nil {
+		return true, nil
+	}
+	return hooks.abort(ctx, hooks.hooks.AfterCreate(ctx, authToken(ctx), hooks.collection, id, element))
+}
+
+// afterCreateElement runs the AfterCreate hook on one of many created
+// elements. Instead of rendering the response of the aborted request,
+// it returns the error message of the element (nil if the hook did not
+// fail), since the other elements were also created.
+func (hooks *Hooks) afterCreateElement(ctx echo.Context, id primitive.ObjectID, element any) echo.Map {
+	if hooks == nil || hooks.hooks.AfterCreate == nil {
+		return nil
+	} else if err := hooks.hooks.AfterCreate(ctx, authToken(ctx), hooks.collection, id, element); err != nil {
+		return errorElement(err, hooks.logger)
+	}
+	return nil
+}
+
+// beforeReplace runs the BeforeReplace hook.
+func (hooks *Hooks) beforeReplace(ctx echo.Context, id primitive.ObjectID, element any) (bool, error) {
+	if hooks == nil || hooks.hooks.BeforeReplace == nil {
+		return true, nil
+	}
+	return hooks.abort(ctx, hooks.hooks.BeforeReplace(ctx, authToken(ctx), hooks.collection, id, element))
+}
+
+// beforeUpdate runs the BeforeUpdate hook, given the stored element
+// and its updated contents.
+func (hooks *Hooks) beforeUpdate(ctx echo.Context, id primitive.ObjectID, original bson.Raw, element any) (bool, error) {
+	if hooks == nil || hooks.hooks.BeforeUpdate == nil {
+		return true, nil
+	}
+	old := hooks.make_()
+	if err := bson.Unmarshal(original, old); err != nil {
+		return hooks.abort(ctx, err)
+	}
+	return hooks.abort(ctx, hooks.hooks.BeforeUpdate(ctx, authToken(ctx), hooks.collection, id, old, element))
+}
+
+// afterUpdate runs the AfterUpdate hook.
+func (hooks *Hooks) afterUpdate(ctx echo.Context, id primitive.ObjectID, element any) (bool, error) {
+	if hooks == nil || hooks.hooks.AfterUpdate == nil {
+		return true, nil
+	}
+	return hooks.abort(ctx, hooks.hooks.AfterUpdate(ctx, authToken(ctx), hooks.collection, id, element))
+}
+
+// beforeDelete runs the BeforeDelete hook.
+func (hooks *Hooks) beforeDelete(ctx echo.Context, id primitive.ObjectID) (bool, error) {
+	if hooks == nil || hooks.hooks.BeforeDelete == nil {
+		return true, nil
+	}
+	return hooks.abort(ctx, hooks.hooks.BeforeDelete(ctx, authToken(ctx), hooks.collection, id))
+}
+
+// afterDelete runs the AfterDelete hook.
+func (hooks *Hooks) afterDelete(ctx echo.Context, id primitive.ObjectID) (bool, error) {
+	if hooks == nil || hooks.hooks.AfterDelete == nil {
+		return true, nil
+	}
+	return hooks.abort(ctx, hooks.hooks.AfterDelete(ctx, authToken(ctx), hooks.collection, id))
+}
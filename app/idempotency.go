@@ -0,0 +1,227 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/responses"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// idempotencyKeyHeader is the header telling the idempotency key
+	// of a request.
+	idempotencyKeyHeader = "Idempotency-Key"
+
+	// idempotencyKeyMaxLength is the maximum length of an idempotency
+	// key.
+	idempotencyKeyMaxLength = 255
+
+	// idempotencyStoreAttempts is how many times storing a response is
+	// attempted before giving up.
+	idempotencyStoreAttempts = 3
+
+	// idempotencyStoreBackoff is the time to wait before attempting to
+	// store a response again (multiplied by the attempts so far).
+	idempotencyStoreBackoff = 100 * time.Millisecond
+)
+
+// idempotencyReplayedHeaders are the response headers that are stored
+// and replayed, besides the body and the status.
+var idempotencyReplayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// idempotencyRecord is the stored response of a request made with an
+// idempotency key (by a given API key). While the request is being
+// processed, the record is pending. Records are removed (and can be
+// claimed again) once they expire: pending ones when their lease ends,
+// and stored ones when their TTL ends.
+type idempotencyRecord struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Key         string             `bson:"key"`
+	ApiKey      string             `bson:"api-key"`
+	Fingerprint string             `bson:"fingerprint"`
+	Pending     bool               `bson:"pending"`
+	Status      int                `bson:"status,omitempty"`
+	Headers     map[string]string  `bson:"headers,omitempty"`
+	Body        []byte             `bson:"body,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at"`
+	ExpiresAt   time.Time          `bson:"expires_at"`
+}
+
+// IdempotentFunc stands for a function that runs a handler only once
+// per idempotency key (if the request tells one), replaying the stored
+// response on retries.
+type IdempotentFunc func(echo.Context, func() error) error
+
+// recordingWriter is a response writer that also keeps a copy of the
+// written body.
+type recordingWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write writes the body and keeps a copy of it.
+func (writer *recordingWriter) Write(content []byte) (int, error) {
+	writer.body.Write(content)
+	return writer.ResponseWriter.Write(content)
+}
+
+// hashOf returns the hex-encoded SHA-256 of the given parts.
+func hashOf(parts ...[]byte) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write(part)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replayIdempotent renders a stored response.
+func replayIdempotent(ctx echo.Context, record *idempotencyRecord) error {
+	header := ctx.Response().Header()
+	for key, value := range record.Headers {
+		header.Set(key, value)
+	}
+	header.Set("Idempotent-Replayed", "true")
+	if len(record.Body) == 0 {
+		return ctx.NoContent(record.Status)
+	}
+	return ctx.Blob(record.Status, record.Headers["Content-Type"], record.Body)
+}
+
+// makeIdempotent makes a function that runs handlers honouring the
+// Idempotency-Key header. The first response to a key (scoped by the
+// API key) is stored for some time, and replayed when the request is
+// retried. Reusing a key for another request (a different method, path
+// or body) is a conflict, and so is retrying a request which is still
+// being processed. Server errors are not stored, so they can be retried.
+// The bookkeeping writes are not cancelled when the client disconnects,
+// and a key is never released once a successful response was written:
+// if the response cannot be stored, the key is held (pending) until the
+// TTL ends, so the request is not run again meanwhile.
+func makeIdempotent(
+	collection *mongo.Collection, ttl, lease time.Duration, logger *slog.Logger,
+) IdempotentFunc {
+	return func(ctx echo.Context, handler func() error) error {
+		key := ctx.Request().Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			return handler()
+		} else if len(key) > idempotencyKeyMaxLength {
+			return responses.InvalidIdempotencyKey(ctx)
+		}
+
+		// Fingerprint the request, keeping its body.
+		body, err := io.ReadAll(ctx.Request().Body)
+		if err != nil {
+			return responses.UnexpectedFormat(ctx)
+		}
+		ctx.Request().Body = io.NopCloser(bytes.NewReader(body))
+		request := ctx.Request()
+		fingerprint := hashOf([]byte(request.Method), []byte(request.URL.RequestURI()), body)
+		apiKey := hashOf([]byte(strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")))
+		bookkeeping := context.WithoutCancel(request.Context())
+
+		// Claim the key or, if it was already claimed, replay the response.
+		createdAt := now()
+		record := idempotencyRecord{
+			Key: key, ApiKey: apiKey, Fingerprint: fingerprint, Pending: true,
+			CreatedAt: createdAt, ExpiresAt: createdAt.Add(lease),
+		}
+		for {
+			result, err := collection.InsertOne(bookkeeping, record)
+			if err == nil {
+				record.ID = result.InsertedID.(primitive.ObjectID)
+				break
+			} else if !mongo.IsDuplicateKeyError(err) {
+				logger.Error("An error occurred: " + err.Error())
+				return responses.InternalError(ctx)
+			}
+
+			existing := idempotencyRecord{}
+			if err := collection.FindOne(
+				bookkeeping, bson.M{"key": key, "api-key": apiKey},
+			).Decode(&existing); errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			} else if err != nil {
+				logger.Error("An error occurred: " + err.Error())
+				return responses.InternalError(ctx)
+			} else if time.Now().After(existing.ExpiresAt) {
+				// Expired, but not yet removed: claim it again.
+				if _, err := collection.DeleteOne(bookkeeping, bson.M{"_id": existing.ID}); err != nil {
+					logger.Error("An error occurred: " + err.Error())
+					return responses.InternalError(ctx)
+				}
+				continue
+			} else if existing.Fingerprint != fingerprint {
+				return responses.IdempotencyConflict(ctx)
+			} else if existing.Pending {
+				return responses.IdempotencyInProgress(ctx)
+			} else {
+				return replayIdempotent(ctx, &existing)
+			}
+		}
+
+		// Run the handler, recording its response. Unless the response
+		// gets stored, the key is released (e.g. on server errors), so
+		// the request can be retried. Successful responses are never
+		// released, even if they could not be stored: the key is held
+		// until its lease ends instead.
+		response := ctx.Response()
+		writer := &recordingWriter{ResponseWriter: response.Writer}
+		response.Writer = writer
+		stored := false
+		defer func() {
+			response.Writer = writer.ResponseWriter
+			succeeded := response.Committed && response.Status >= http.StatusOK &&
+				response.Status < http.StatusMultipleChoices
+			if !stored && !succeeded {
+				if _, err := collection.DeleteOne(bookkeeping, bson.M{"_id": record.ID}); err != nil {
+					logger.Error("An error occurred: " + err.Error())
+				}
+			}
+		}()
+		if err = handler(); err != nil || !response.Committed || response.Status >= http.StatusInternalServerError {
+			return err
+		}
+
+		// Store the response.
+		headers := map[string]string{}
+		for _, name := range idempotencyReplayedHeaders {
+			if value := response.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		update := bson.M{"$set": bson.M{
+			"pending": false, "status": response.Status, "headers": headers, "body": writer.body.Bytes(),
+			"expires_at": now().Add(ttl),
+		}}
+		for attempt := 0; attempt < idempotencyStoreAttempts && !stored; attempt++ {
+			time.Sleep(time.Duration(attempt) * idempotencyStoreBackoff)
+			if _, err := collection.UpdateOne(bookkeeping, bson.M{"_id": record.ID}, update); err != nil {
+				logger.Error("An error occurred: " + err.Error())
+			} else {
+				stored = true
+			}
+		}
+		if !stored {
+			// Hold the key for the whole TTL, so the request cannot be
+			// run again (retries are told it is still in progress).
+			if _, err := collection.UpdateOne(bookkeeping, bson.M{"_id": record.ID}, bson.M{"$set": bson.M{
+				"expires_at": now().Add(ttl),
+			}}); err != nil {
+				logger.Error("An error occurred: " + err.Error())
+			}
+		}
+		return nil
+	}
+}
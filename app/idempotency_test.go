@@ -0,0 +1,120 @@
+package app
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHashOf(t *testing.T) {
+	cases := []struct {
+		name  string
+		parts [][]byte
+		other [][]byte
+	}{
+		{"tells the parts apart", [][]byte{[]byte("ab"), []byte("c")}, [][]byte{[]byte("a"), []byte("bc")}},
+		{"tells empty parts apart", [][]byte{[]byte("a"), {}}, [][]byte{[]byte("a")}},
+		{
+			"tells other bodies apart", [][]byte{[]byte("POST"), []byte("/items"), []byte(`{"a":1}`)},
+			[][]byte{[]byte("POST"), []byte("/items"), []byte(`{"a":2}`)},
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if hash := hashOf(case_.parts...); hash != hashOf(case_.parts...) {
+				t.Fatalf("expected the same hash for the same parts")
+			} else if len(hash) != 64 {
+				t.Fatalf("expected a hex-encoded SHA-256, got %s", hash)
+			} else if other := hashOf(case_.other...); other == hash {
+				t.Fatalf("expected %v and %v to have different hashes", case_.parts, case_.other)
+			}
+		})
+	}
+}
+
+func TestReplayIdempotent(t *testing.T) {
+	cases := []struct {
+		name   string
+		record idempotencyRecord
+		body   string
+	}{
+		{
+			"replays the body and headers",
+			idempotencyRecord{
+				Status: http.StatusCreated, Body: []byte(`{"id":"x"}`),
+				Headers: map[string]string{"Content-Type": "application/json", "Location": "/items/x"},
+			},
+			`{"id":"x"}`,
+		},
+		{"replays empty bodies", idempotencyRecord{Status: http.StatusNoContent}, ""},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			ctx, recorder := newTestContext(http.MethodPost, "/", nil)
+			if err := replayIdempotent(ctx, &case_.record); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if recorder.Code != case_.record.Status {
+				t.Fatalf("expected status %d, got %d", case_.record.Status, recorder.Code)
+			} else if body := recorder.Body.String(); body != case_.body {
+				t.Fatalf("expected the body %s, got %s", case_.body, body)
+			} else if recorder.Header().Get("Idempotent-Replayed") != "true" {
+				t.Fatalf("expected the Idempotent-Replayed header")
+			}
+			for key, value := range case_.record.Headers {
+				if recorder.Header().Get(key) != value {
+					t.Fatalf("expected the header %s to be %s, got %s", key, value, recorder.Header().Get(key))
+				}
+			}
+		})
+	}
+}
+
+func TestRecordingWriter(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := &recordingWriter{ResponseWriter: recorder}
+	_, _ = writer.Write([]byte("ab"))
+	_, _ = writer.Write([]byte("c"))
+	if writer.body.String() != "abc" || recorder.Body.String() != "abc" {
+		t.Fatalf("expected abc to be written and kept, got %s and %s", recorder.Body.String(), writer.body.String())
+	}
+}
+
+func TestIdempotentWithoutStoring(t *testing.T) {
+	// These requests never reach the collection.
+	idempotent := makeIdempotent(nil, time.Hour, time.Minute, slog.Default())
+	cases := []struct {
+		name   string
+		key    string
+		runs   bool
+		status int
+	}{
+		{"runs requests without a key", "", true, http.StatusOK},
+		{"rejects too long keys", strings.Repeat("x", idempotencyKeyMaxLength+1), false, http.StatusBadRequest},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			header := map[string]string{}
+			if case_.key != "" {
+				header[idempotencyKeyHeader] = case_.key
+			}
+			ctx, recorder := newTestContext(http.MethodPost, "/", header)
+			runs := false
+			if err := idempotent(ctx, func() error {
+				runs = true
+				return ctx.NoContent(http.StatusOK)
+			}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if runs != case_.runs {
+				t.Fatalf("expected the handler to run: %v, got %v", case_.runs, runs)
+			} else if recorder.Code != case_.status {
+				t.Fatalf("expected status %d, got %d", case_.status, recorder.Code)
+			}
+		})
+	}
+}
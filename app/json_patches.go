@@ -0,0 +1,239 @@
+package app
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// mergePatchContentType is the content type of JSON Merge Patch
+	// (RFC 7396) bodies.
+	mergePatchContentType = "application/merge-patch+json"
+
+	// jsonPatchContentType is the content type of JSON Patch (RFC 6902)
+	// bodies.
+	jsonPatchContentType = "application/json-patch+json"
+)
+
+// jsonPatchOperators maps the JSON Patch operations to the update
+// operator they are allowed by, in a patch policy. The "test" one
+// needs no operator, since it does not write anything.
+var jsonPatchOperators = map[string]string{
+	"add": "$set", "remove": "$unset", "replace": "$set", "move": "$rename", "copy": "$set", "test": "",
+}
+
+// mergeObjectOperator is the operation that a JSON Merge Patch uses to
+// ensure the target of a nested object is an object: when it is not
+// (or it is missing), it is replaced by an empty object, and then the
+// members of the nested object are merged into it. It is allowed by
+// the $set operator in a patch policy.
+const mergeObjectOperator = "merge"
+
+// parseMergePatch converts a JSON Merge Patch into update operations:
+// null values become $unset operations, objects are merged recursively
+// (replacing the targets that are not objects, as RFC 7396 tells), and
+// any other value becomes a $set operation. The errors are keyed by
+// path.
+func parseMergePatch(patch map[string]any) ([]PatchOperation, map[string][]string) {
+	operations := []PatchOperation{}
+	errors := map[string][]string{}
+
+	var walk func(prefix string, patch map[string]any)
+	walk = func(prefix string, patch map[string]any) {
+		for _, key := range sortedKeys(patch) {
+			path := prefix + key
+			value := normalizePatchValue(patch[key])
+			if strings.Contains(key, ".") || !validPatchPath(key) {
+				addQueryError(errors, path, "path")
+			} else if path == "_id" {
+				addQueryError(errors, path, "immutable")
+			} else if value == nil {
+				operations = append(operations, PatchOperation{Operator: "$unset", Path: path})
+			} else if object, ok := value.(map[string]any); ok {
+				operations = append(operations, PatchOperation{Operator: mergeObjectOperator, Path: path})
+				walk(path+".", object)
+			} else {
+				operations = append(operations, PatchOperation{Operator: "$set", Path: path, Value: value})
+			}
+		}
+	}
+	walk("", patch)
+
+	return operations, errors
+}
+
+// pointerToPath converts a JSON Pointer into a dotted path. Pointers
+// to the whole document, or with segments that cannot be expressed
+// in a dotted path, are not valid.
+func pointerToPath(pointer string) (string, bool) {
+	if !strings.HasPrefix(pointer, "/") {
+		return "", false
+	}
+	parts := strings.Split(pointer[1:], "/")
+	for index, part := range parts {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		if part == "" || strings.Contains(part, ".") || strings.HasPrefix(part, "$") {
+			return "", false
+		}
+		parts[index] = part
+	}
+	return strings.Join(parts, "."), true
+}
+
+// parseJSONPatch converts a JSON Patch into operations, which are
+// applied in order. The errors are keyed by the index of the offending
+// operation.
+func parseJSONPatch(patch []any) ([]PatchOperation, map[string][]string) {
+	operations := []PatchOperation{}
+	errors := map[string][]string{}
+
+	for index, item := range patch {
+		key := strconv.Itoa(index)
+		fields, ok := normalizePatchValue(item).(map[string]any)
+		if !ok {
+			addQueryError(errors, key, "syntax")
+			continue
+		}
+		op, _ := fields["op"].(string)
+		if _, ok := jsonPatchOperators[op]; !ok {
+			addQueryError(errors, key, "op")
+			continue
+		}
+		pointer, _ := fields["path"].(string)
+		path, ok := pointerToPath(pointer)
+		if !ok {
+			addQueryError(errors, key, "path")
+			continue
+		}
+
+		operation := PatchOperation{Operator: op, Path: path, Value: fields["value"]}
+		switch op {
+		case "add", "replace", "test":
+			if _, ok := fields["value"]; !ok {
+				addQueryError(errors, key, "value")
+				continue
+			}
+		case "move", "copy":
+			from, _ := fields["from"].(string)
+			if operation.From, ok = pointerToPath(from); !ok {
+				addQueryError(errors, key, "from")
+				continue
+			} else if op == "move" && strings.HasPrefix(path, operation.From+".") {
+				addQueryError(errors, key, "from")
+				continue
+			}
+		}
+
+		if op != "test" && (path == "_id" || strings.HasPrefix(path, "_id.")) {
+			addQueryError(errors, key, "immutable")
+		} else if op == "move" && (operation.From == "_id" || strings.HasPrefix(operation.From, "_id.")) {
+			addQueryError(errors, key, "immutable")
+		} else {
+			operations = append(operations, operation)
+		}
+	}
+
+	return operations, errors
+}
+
+// updateParent replaces the parent of the last segment of a path in a
+// container with the result of a function, which is given the parent
+// and the last segment. The parent must exist.
+func updateParent(container any, parts []string, update func(any, string) (any, error)) (any, error) {
+	if len(parts) == 1 {
+		return update(container, parts[0])
+	}
+	next, ok := getChild(container, parts[0])
+	if !ok {
+		return nil, errPatchPath
+	}
+	if updated, err := updateParent(next, parts[1:], update); err != nil {
+		return nil, err
+	} else {
+		return setChild(container, parts[0], updated)
+	}
+}
+
+// insertPath adds a value at a path, like the JSON Patch "add": in
+// arrays, the value is inserted at the index (or appended, if the
+// index is "-"), while in documents the value is set.
+func insertPath(document map[string]any, path string, value any) error {
+	_, err := updateParent(document, strings.Split(path, "."), func(parent any, key string) (any, error) {
+		if array, ok := parent.([]any); ok {
+			if key == "-" {
+				return append(array, value), nil
+			}
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index > len(array) {
+				return nil, errPatchPath
+			}
+			return slices.Insert(array, index, value), nil
+		}
+		return setChild(parent, key, value)
+	})
+	return err
+}
+
+// deletePath removes an existing value at a path, like the JSON Patch
+// "remove": array elements are removed, shifting the following ones.
+func deletePath(document map[string]any, path string) error {
+	_, err := updateParent(document, strings.Split(path, "."), func(parent any, key string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			if _, ok := p[key]; !ok {
+				return nil, errPatchPath
+			}
+			delete(p, key)
+			return p, nil
+		case []any:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(p) {
+				return nil, errPatchPath
+			}
+			return slices.Delete(p, index, index+1), nil
+		default:
+			return nil, errPatchPath
+		}
+	})
+	return err
+}
+
+// applyJSONPatchOperation applies a single JSON Patch operation (or a
+// JSON Merge Patch object merge) to a (normalized) document. It tells
+// whether the operation is a failed "test" one.
+func applyJSONPatchOperation(document map[string]any, operation PatchOperation) (bool, error) {
+	switch operation.Operator {
+	case mergeObjectOperator:
+		if value, found := lookupPath(document, operation.Path); found {
+			if _, ok := value.(map[string]any); ok {
+				return false, nil
+			}
+		}
+		return false, setPath(document, operation.Path, map[string]any{})
+	case "add":
+		return false, insertPath(document, operation.Path, normalizePatchValue(operation.Value))
+	case "remove":
+		return false, deletePath(document, operation.Path)
+	case "replace":
+		if _, found := lookupPath(document, operation.Path); !found {
+			return false, errPatchPath
+		}
+		return false, setPath(document, operation.Path, normalizePatchValue(operation.Value))
+	case "move", "copy":
+		value, found := lookupPath(document, operation.From)
+		if !found {
+			return false, errPatchPath
+		}
+		if operation.Operator == "move" {
+			if err := deletePath(document, operation.From); err != nil {
+				return false, err
+			}
+		}
+		return false, insertPath(document, operation.Path, normalizePatchValue(value))
+	case "test":
+		value, found := lookupPath(document, operation.Path)
+		return !found || !valuesEqual(value, normalizePatchValue(operation.Value)), nil
+	}
+	return false, nil
+}
@@ -0,0 +1,217 @@
+package app
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// decodeJSON decodes a JSON text, failing the test on error.
+func decodeJSON[T any](t *testing.T, text string) T {
+	t.Helper()
+	var value T
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		t.Fatalf("invalid JSON %s: %v", text, err)
+	}
+	return value
+}
+
+// The examples of RFC 7396 (section 3 and appendix A) whose target and
+// patch are objects, since elements are always documents.
+func TestMergePatch(t *testing.T) {
+	cases := []struct {
+		name     string
+		target   string
+		patch    string
+		expected string
+	}{
+		{"replaces a member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"adds a member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"removes the only member", `{"a":"b"}`, `{"a":null}`, `{}`},
+		{"removes a member", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"replaces an array by a value", `{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"replaces a value by an array", `{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{"merges nested objects", `{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{"replaces arrays", `{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{"keeps existing nulls", `{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{"creates nested objects without nulls", `{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{"replaces a string by an object", `{"a":"x"}`, `{"a":{"b":1}}`, `{"a":{"b":1}}`},
+		{"replaces an array by an object", `{"a":[1,2]}`, `{"a":{"0":3}}`, `{"a":{"0":3}}`},
+		{"replaces a string by an emptied object", `{"a":"x"}`, `{"a":{"b":null}}`, `{"a":{}}`},
+		{"creates empty objects", `{}`, `{"a":{}}`, `{"a":{}}`},
+		{"keeps objects merged with empty objects", `{"a":{"b":1}}`, `{"a":{}}`, `{"a":{"b":1}}`},
+		{
+			"merges the example document",
+			`{"title":"Goodbye!","author":{"givenName":"John","familyName":"Doe"},"tags":["example","sample"],
+			"content":"This will be unchanged"}`,
+			`{"title":"Hello!","phoneNumber":"+01-123-456-7890","author":{"familyName":null},"tags":["example"]}`,
+			`{"title":"Hello!","author":{"givenName":"John"},"tags":["example"],"content":"This will be unchanged",
+			"phoneNumber":"+01-123-456-7890"}`,
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			document := decodeJSON[map[string]any](t, case_.target)
+			operations, errors := parseMergePatch(decodeJSON[map[string]any](t, case_.patch))
+			if len(errors) == 0 {
+				errors = applyPatch(document, operations)
+			}
+			if len(errors) != 0 {
+				t.Fatalf("unexpected errors: %v", errors)
+			}
+			if expected := decodeJSON[map[string]any](t, case_.expected); !reflect.DeepEqual(document, expected) {
+				t.Fatalf("expected %v, got %v", expected, document)
+			}
+		})
+	}
+}
+
+func TestMergePatchErrors(t *testing.T) {
+	_, errors := parseMergePatch(decodeJSON[map[string]any](t, `{"_id":1,"a.b":1,"c":{"$d":1}}`))
+	expected := map[string][]string{"_id": {"immutable"}, "a.b": {"path"}, "c.$d": {"path"}}
+	if !reflect.DeepEqual(errors, expected) {
+		t.Fatalf("expected %v, got %v", expected, errors)
+	}
+}
+
+// The examples of RFC 6902 (appendix A) whose target is an object and
+// whose patch is valid JSON, plus the copy operation.
+func TestJSONPatch(t *testing.T) {
+	cases := []struct {
+		name     string
+		target   string
+		patch    string
+		expected string
+		errors   map[string][]string
+	}{
+		{
+			name:     "adds an object member",
+			target:   `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz","value":"qux"}]`,
+			expected: `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:     "adds an array element",
+			target:   `{"foo":["bar","baz"]}`,
+			patch:    `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			expected: `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:     "removes an object member",
+			target:   `{"baz":"qux","foo":"bar"}`,
+			patch:    `[{"op":"remove","path":"/baz"}]`,
+			expected: `{"foo":"bar"}`,
+		},
+		{
+			name:     "removes an array element",
+			target:   `{"foo":["bar","qux","baz"]}`,
+			patch:    `[{"op":"remove","path":"/foo/1"}]`,
+			expected: `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:     "replaces a value",
+			target:   `{"baz":"qux","foo":"bar"}`,
+			patch:    `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			expected: `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:     "moves a value",
+			target:   `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch:    `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			expected: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:     "moves an array element",
+			target:   `{"foo":["all","grass","cows","eat"]}`,
+			patch:    `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			expected: `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:     "tests values successfully",
+			target:   `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch:    `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			expected: `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:   "fails a test",
+			target: `{"baz":"qux"}`,
+			patch:  `[{"op":"test","path":"/baz","value":"bar"}]`,
+			errors: map[string][]string{"test.baz": {"test"}},
+		},
+		{
+			name:     "adds a nested member object",
+			target:   `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			expected: `{"foo":"bar","child":{"grandchild":{}}}`,
+		},
+		{
+			name:     "ignores unrecognized elements",
+			target:   `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`,
+			expected: `{"foo":"bar","baz":"qux"}`,
+		},
+		{
+			name:   "fails adding to a nonexistent target",
+			target: `{"foo":"bar"}`,
+			patch:  `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			errors: map[string][]string{"add.baz.bat": {"path"}},
+		},
+		{
+			name:     "unescapes the pointers",
+			target:   `{"/":9,"~1":10}`,
+			patch:    `[{"op":"test","path":"/~01","value":10}]`,
+			expected: `{"/":9,"~1":10}`,
+		},
+		{
+			name:   "compares strings and numbers",
+			target: `{"/":9,"~1":10}`,
+			patch:  `[{"op":"test","path":"/~01","value":"10"}]`,
+			errors: map[string][]string{"test.~1": {"test"}},
+		},
+		{
+			name:     "adds an array value",
+			target:   `{"foo":["bar"]}`,
+			patch:    `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			expected: `{"foo":["bar",["abc","def"]]}`,
+		},
+		{
+			name:     "copies a value",
+			target:   `{"foo":{"bar":[1]}}`,
+			patch:    `[{"op":"copy","from":"/foo/bar","path":"/baz"},{"op":"add","path":"/baz/-","value":2}]`,
+			expected: `{"foo":{"bar":[1]},"baz":[1,2]}`,
+		},
+		{
+			name:   "fails replacing a missing value",
+			target: `{}`,
+			patch:  `[{"op":"replace","path":"/foo","value":1}]`,
+			errors: map[string][]string{"replace.foo": {"path"}},
+		},
+		{
+			name:   "rejects invalid operations",
+			target: `{}`,
+			patch: `[{"op":"inc","path":"/a"},{"op":"add","path":"a","value":1},{"op":"add","path":"/a"},
+			{"op":"move","from":"/a","path":"/a/b"},{"op":"remove","path":"/_id"}]`,
+			errors: map[string][]string{
+				"0": {"op"}, "1": {"path"}, "2": {"value"}, "3": {"from"}, "4": {"immutable"},
+			},
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			document := decodeJSON[map[string]any](t, case_.target)
+			operations, errors := parseJSONPatch(decodeJSON[[]any](t, case_.patch))
+			if len(errors) == 0 {
+				errors = applyPatch(document, operations)
+			}
+			if len(case_.errors) != 0 || len(errors) != 0 {
+				if !reflect.DeepEqual(errors, case_.errors) {
+					t.Fatalf("expected errors %v, got %v", case_.errors, errors)
+				}
+			} else if expected := decodeJSON[map[string]any](t, case_.expected); !reflect.DeepEqual(document, expected) {
+				t.Fatalf("expected %v, got %v", expected, document)
+			}
+		})
+	}
+}
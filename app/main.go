@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
 	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/responses"
@@ -16,6 +17,15 @@ import (
 	"os"
 	"runtime/debug"
 	"strings"
+	"time"
+)
+
+// The codes of the MongoDB errors that are expected while preparing
+// the indices.
+const (
+	namespaceNotFoundCode    = 26
+	indexNotFoundCode        = 27
+	indexOptionsConflictCode = 85
 )
 
 // Panicked is a class that wraps a panicked value into an error.
@@ -97,9 +107,6 @@ func MakeServer(
 
 	// Make the validator to use and validate the settings.
 	slog.Info("Init::Validating the settings")
-	if settings.Global.ListMaxResults <= 0 {
-		settings.Global.ListMaxResults = dsl.DefaultListMaxSize
-	}
 	settingsValidator := validation.Validator()
 	if err = settingsValidator.Struct(settings); err != nil {
 		return
@@ -130,8 +137,8 @@ func MakeServer(
 	slog.Info("Init::Defining the resources")
 	for resourceKey, resource := range settings.Resources {
 		registerEndpoints(
-			client, router, resourceKey, &resource, &settings.Auth, resourcesValidatorMaker,
-			settings.Global.ListMaxResults, logger,
+			client, router, resourceKey, &resource, &settings.Auth, &settings.Idempotency, resourcesValidatorMaker,
+			&settings.Global, logger,
 		)
 	}
 	router.Any("/*", func(c echo.Context) error {
@@ -173,7 +180,61 @@ func prepareIndices(client *mongo.Client, settings *dsl.Settings) (err error) {
 		return
 	}
 
+	idempotencyIndices := client.Database(settings.Idempotency.Db).Collection(settings.Idempotency.Collection).Indexes()
+	keyName := "idempotency-key"
+	ttlName := "expires-at-ttl"
+	expireAfter := int32(0)
+	slog.Info(fmt.Sprintf(
+		"Init/Indices::Creating indices for idempotency db=%s table=%s",
+		settings.Idempotency.Db, settings.Idempotency.Collection,
+	))
+	if _, err = idempotencyIndices.CreateMany(
+		bg, []mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "key", Value: 1}, {Key: "api-key", Value: 1}},
+				Options: &options.IndexOptions{
+					Name:   &keyName,
+					Unique: &unique,
+				},
+			},
+			{
+				// Each record tells when it expires, so the TTL
+				// and the lease can change without changing this.
+				Keys: bson.D{{Key: "expires_at", Value: 1}},
+				Options: &options.IndexOptions{
+					Name:               &ttlName,
+					ExpireAfterSeconds: &expireAfter,
+				},
+			},
+		},
+	); err != nil {
+		return
+	}
+
 	for _, resource := range settings.Resources {
+		if resource.SoftDelete {
+			// The soft-deleted elements are purged after some time.
+			collection := client.Database(resource.Db).Collection(resource.Collection)
+			if err = ensureTTLIndex(bg, collection, "deleted-at-purge", deletedAtField, resource.PurgeAfter); err != nil {
+				return
+			}
+		}
+		if resource.History {
+			// The revisions are numbered for each element.
+			name := "element-revision"
+			collection := historyCollection(client, &resource)
+			if _, err = collection.Indexes().CreateOne(
+				bg, mongo.IndexModel{
+					Keys: bson.D{{Key: "element", Value: 1}, {Key: "revision", Value: 1}},
+					Options: &options.IndexOptions{
+						Name:   &name,
+						Unique: &unique,
+					},
+				},
+			); err != nil {
+				return
+			}
+		}
 		for name, index := range resource.Indexes {
 			unique := index.Unique
 			fields := index.Fields
@@ -192,6 +253,9 @@ func prepareIndices(client *mongo.Client, settings *dsl.Settings) (err error) {
 				default:
 					type_ = 1
 				}
+				if type_ != 1 {
+					field = field[1:]
+				}
 				fieldsMap = append(fieldsMap, bson.E{Key: field, Value: type_})
 			}
 			if _, err = client.Database(resource.Db).Collection(resource.Collection).Indexes().CreateOne(
@@ -211,3 +275,40 @@ func prepareIndices(client *mongo.Client, settings *dsl.Settings) (err error) {
 
 	return
 }
+
+// ensureTTLIndex creates or updates a TTL index on a field, so the
+// documents expire after the given time. If the index exists with
+// another time, it is updated. If the time is zero, the index is
+// dropped instead (if it exists).
+func ensureTTLIndex(
+	ctx context.Context, collection *mongo.Collection, name, field string, expireAfter time.Duration,
+) error {
+	if expireAfter <= 0 {
+		var cmdErr mongo.CommandError
+		if _, err := collection.Indexes().DropOne(ctx, name); err != nil &&
+			!(errors.As(err, &cmdErr) && (cmdErr.Code == indexNotFoundCode || cmdErr.Code == namespaceNotFoundCode)) {
+			return err
+		}
+		return nil
+	}
+
+	seconds := int32(expireAfter.Seconds())
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: field, Value: 1}},
+		Options: &options.IndexOptions{
+			Name:               &name,
+			ExpireAfterSeconds: &seconds,
+		},
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == indexOptionsConflictCode {
+		slog.Info(fmt.Sprintf(
+			"Init/Indices::Updating the expiration of index=%s table=%s", name, collection.Name(),
+		))
+		return collection.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: collection.Name()},
+			{Key: "index", Value: bson.D{{Key: "name", Value: name}, {Key: "expireAfterSeconds", Value: seconds}}},
+		}).Err()
+	}
+	return err
+}
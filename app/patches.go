@@ -0,0 +1,715 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/formats"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errPatchPath is returned when a path cannot be traversed in a
+// document (e.g. it goes through a scalar value).
+var errPatchPath = errors.New("invalid patch path")
+
+// patchOperators are the supported update operators.
+var patchOperators = map[string]bool{
+	"$set": true, "$unset": true, "$inc": true, "$mul": true, "$min": true, "$max": true,
+	"$push": true, "$pull": true, "$addToSet": true, "$rename": true,
+}
+
+// PatchOperation stands for a single operation of a patch: an update
+// operator (or a JSON Patch operation) applied to a field path, with
+// its argument and, for JSON Patch "move" and "copy" operations, the
+// source path.
+type PatchOperation struct {
+	Operator string
+	Path     string
+	Value    any
+	From     string
+}
+
+// PatchFunc stands for a function that applies the operations of a
+// patch to a raw document, returning the patched element (as a new
+// instance of the model type). The errors of the operations that
+// cannot be applied to the document are returned by operation.
+type PatchFunc func(bson.Raw, []PatchOperation) (any, map[string][]string, error)
+
+// PatchPolicyFunc stands for a function that checks the operations
+// of a patch against the resource's patch policy. The errors are keyed
+// by operator or by operator and path, like the patch errors.
+type PatchPolicyFunc func([]PatchOperation) map[string][]string
+
+// sortedKeys returns the keys of a map, sorted.
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalizePatchValue converts a value (coming either from JSON or from
+// BSON) so every document is a map[string]any and every array is a []any.
+func normalizePatchValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[key] = normalizePatchValue(item)
+		}
+		return result
+	case bson.M:
+		return normalizePatchValue(map[string]any(v))
+	case bson.D:
+		result := make(map[string]any, len(v))
+		for _, item := range v {
+			result[item.Key] = normalizePatchValue(item.Value)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for index, item := range v {
+			result[index] = normalizePatchValue(item)
+		}
+		return result
+	case bson.A:
+		return normalizePatchValue([]any(v))
+	default:
+		return value
+	}
+}
+
+// validPatchPath tells whether a path is made of non-empty segments
+// that are not operators.
+func validPatchPath(path string) bool {
+	for _, part := range strings.Split(path, ".") {
+		if part == "" || strings.HasPrefix(part, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// pathsOverlap tells whether two paths are the same, or one of them
+// is an ancestor of the other.
+func pathsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
+
+// isModifierDoc tells whether a value is a document of modifiers
+// (i.e. all its keys start with $).
+func isModifierDoc(value any) (map[string]any, bool) {
+	doc, ok := value.(map[string]any)
+	if !ok || len(doc) == 0 {
+		return nil, false
+	}
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// parsePatch parses a patch made of update operators, ensuring the
+// operators are supported, the paths are valid and do not conflict,
+// and the arguments are well-formed. The errors are keyed by operator
+// or by operator and path (e.g. "$inc.amount").
+func parsePatch(updates map[string]any) ([]PatchOperation, map[string][]string) {
+	operations := []PatchOperation{}
+	errors := map[string][]string{}
+	var touched []string
+
+	for _, operator := range sortedKeys(updates) {
+		if !strings.HasPrefix(operator, "$") {
+			addQueryError(errors, operator, "operator")
+			continue
+		} else if !patchOperators[operator] {
+			addQueryError(errors, operator, "unsupported")
+			continue
+		}
+		fields, ok := normalizePatchValue(updates[operator]).(map[string]any)
+		if !ok || len(fields) == 0 {
+			addQueryError(errors, operator, "syntax")
+			continue
+		}
+
+		for _, path := range sortedKeys(fields) {
+			key := operator + "." + path
+			value := fields[path]
+			paths := []string{path}
+			if !validPatchPath(path) {
+				addQueryError(errors, key, "path")
+				continue
+			}
+
+			switch operator {
+			case "$inc", "$mul":
+				if _, ok := toFloat(value); !ok {
+					addQueryError(errors, key, "type")
+					continue
+				}
+			case "$rename":
+				if target, ok := value.(string); !ok || !validPatchPath(target) || pathsOverlap(path, target) {
+					addQueryError(errors, key, "syntax")
+					continue
+				} else {
+					paths = append(paths, target)
+				}
+			case "$push", "$addToSet":
+				if modifiers, ok := isModifierDoc(value); ok {
+					if _, ok := modifiers["$each"].([]any); !ok || len(modifiers) != 1 {
+						addQueryError(errors, key, "modifier")
+						continue
+					}
+				}
+			case "$pull":
+				if modifiers, ok := isModifierDoc(value); ok {
+					if in, ok := modifiers["$in"]; ok {
+						if _, ok := in.([]any); !ok || len(modifiers) != 1 {
+							addQueryError(errors, key, "modifier")
+							continue
+						}
+					} else if _, ok := modifiers["$eq"]; !ok || len(modifiers) != 1 {
+						addQueryError(errors, key, "modifier")
+						continue
+					}
+				}
+			}
+
+			valid := true
+			for _, path_ := range paths {
+				if path_ == "_id" || strings.HasPrefix(path_, "_id.") {
+					addQueryError(errors, key, "immutable")
+					valid = false
+				} else {
+					for _, previous := range touched {
+						if pathsOverlap(path_, previous) {
+							addQueryError(errors, key, "conflict")
+							valid = false
+							break
+						}
+					}
+				}
+			}
+			if valid {
+				touched = append(touched, paths...)
+				operations = append(operations, PatchOperation{Operator: operator, Path: path, Value: value})
+			}
+		}
+	}
+
+	return operations, errors
+}
+
+// makePatchPolicy makes a function that checks the operations of a
+// patch against the given policy. By default, all the operators are
+// allowed and all the fields mapped in the model (but the _id and the
+// protected ones) can be written. If there is an input type, only the
+// fields also mapped in it (with the same name) can be written, so the
+// fields it hides stay hidden. Writing a field allows writing any path
+// inside it. JSON Patch operations are allowed by their equivalent
+// update operators. The write-only fields can be written, but not read:
+// they cannot be tested, nor copied, moved or renamed elsewhere.
+func makePatchPolicy(
+	policy *dsl.PatchPolicy, modelFields, inputFields map[string]reflect.Type, protected, writeOnly []string,
+) PatchPolicyFunc {
+	operators := map[string]bool{}
+	var paths []string
+	if policy != nil {
+		for _, operator := range policy.Operators {
+			operators[string(operator)] = true
+		}
+		for _, path := range policy.Paths {
+			field := strings.SplitN(path, ".", 2)[0]
+			if _, ok := modelFields[field]; !ok || field == "_id" || slices.Contains(protected, field) ||
+				!validPatchPath(path) {
+				panic("the patch policy path is not a writable path in the model: " + path)
+			}
+			paths = append(paths, path)
+		}
+	}
+	if len(operators) == 0 {
+		operators = patchOperators
+	}
+	if len(paths) == 0 {
+		for field := range modelFields {
+			if _, ok := inputFields[field]; inputFields != nil && !ok {
+				continue
+			}
+			if field != "_id" && !slices.Contains(protected, field) {
+				paths = append(paths, field)
+			}
+		}
+	}
+
+	allowed := func(path string) bool {
+		for _, allowedPath := range paths {
+			if path == allowedPath || strings.HasPrefix(path, allowedPath+".") {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Ensuring a path is an object is allowed when the path is allowed,
+	// or when it holds an allowed path (since then it can only replace
+	// a missing value or one which cannot hold the allowed path).
+	holds := func(path string) bool {
+		for _, allowedPath := range paths {
+			if strings.HasPrefix(allowedPath, path+".") {
+				return true
+			}
+		}
+		return allowed(path)
+	}
+
+	hidden := func(path string) bool {
+		return slices.Contains(writeOnly, strings.SplitN(path, ".", 2)[0])
+	}
+
+	return func(operations []PatchOperation) map[string][]string {
+		errors := map[string][]string{}
+		for _, operation := range operations {
+			operator := operation.Operator
+			key := operation.Operator + "." + operation.Path
+			if ((operator == "test" || operator == "$rename") && hidden(operation.Path)) ||
+				((operator == "copy" || operator == "move") && hidden(operation.From)) {
+				addQueryError(errors, key, "write-only")
+				continue
+			} else if operator == mergeObjectOperator {
+				if !operators["$set"] {
+					if _, ok := errors[operator]; !ok {
+						addQueryError(errors, operator, "forbidden")
+					}
+				} else if !holds(operation.Path) {
+					addQueryError(errors, operator+"."+operation.Path, "forbidden")
+				}
+				continue
+			} else if mapped, ok := jsonPatchOperators[operator]; ok {
+				if mapped == "" {
+					// Nothing is written by this operation.
+					continue
+				}
+				operator = mapped
+			}
+			if !operators[operator] {
+				if _, ok := errors[operation.Operator]; !ok {
+					addQueryError(errors, operation.Operator, "forbidden")
+				}
+				continue
+			}
+			if !allowed(operation.Path) {
+				addQueryError(errors, key, "forbidden")
+			} else if target, ok := operation.Value.(string); operator == "$rename" && ok && !allowed(target) {
+				addQueryError(errors, key, "forbidden")
+			} else if operation.Operator == "move" && !allowed(operation.From) {
+				addQueryError(errors, key, "forbidden")
+			}
+		}
+		return errors
+	}
+}
+
+// getChild gets a child of a document or array, by key or index.
+func getChild(container any, key string) (any, bool) {
+	switch c := container.(type) {
+	case map[string]any:
+		value, ok := c[key]
+		return value, ok
+	case []any:
+		if index, err := strconv.Atoi(key); err != nil || index < 0 || index >= len(c) {
+			return nil, false
+		} else {
+			return c[index], true
+		}
+	default:
+		return nil, false
+	}
+}
+
+// setChild sets a child of a document or array, by key or index,
+// returning the (perhaps grown) container. Arrays can only grow by
+// appending an element right after the last one.
+func setChild(container any, key string, value any) (any, error) {
+	switch c := container.(type) {
+	case map[string]any:
+		c[key] = value
+		return c, nil
+	case []any:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index > len(c) {
+			return nil, errPatchPath
+		} else if index == len(c) {
+			return append(c, value), nil
+		}
+		c[index] = value
+		return c, nil
+	default:
+		return nil, errPatchPath
+	}
+}
+
+// lookupPath gets the value at a path in a document.
+func lookupPath(document map[string]any, path string) (any, bool) {
+	var current any = document
+	for _, part := range strings.Split(path, ".") {
+		var ok bool
+		if current, ok = getChild(current, part); !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// setIn sets the value at a path in a container, creating the
+// missing intermediate documents.
+func setIn(container any, parts []string, value any) (any, error) {
+	if len(parts) == 1 {
+		return setChild(container, parts[0], value)
+	}
+	next, ok := getChild(container, parts[0])
+	if !ok {
+		next = map[string]any{}
+	}
+	if updated, err := setIn(next, parts[1:], value); err != nil {
+		return nil, err
+	} else {
+		return setChild(container, parts[0], updated)
+	}
+}
+
+// setPath sets the value at a path in a document.
+func setPath(document map[string]any, path string, value any) error {
+	_, err := setIn(document, strings.Split(path, "."), value)
+	return err
+}
+
+// unsetPath removes the value at a path in a document. Array
+// elements are set to null instead.
+func unsetPath(document map[string]any, path string) {
+	parts := strings.Split(path, ".")
+	var parent any = document
+	if len(parts) > 1 {
+		var ok bool
+		if parent, ok = lookupPath(document, strings.Join(parts[:len(parts)-1], ".")); !ok {
+			return
+		}
+	}
+	last := parts[len(parts)-1]
+	switch p := parent.(type) {
+	case map[string]any:
+		delete(p, last)
+	case []any:
+		if index, err := strconv.Atoi(last); err == nil && index >= 0 && index < len(p) {
+			p[index] = nil
+		}
+	}
+}
+
+// toFloat converts a numeric value to float64.
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// toInt converts an integer value to int64.
+func toInt(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// combineNumbers combines two numbers (an $inc or $mul operation). The
+// result is a double if any of them is a double, or an integer of the
+// widest type among them (widened when it overflows 32 bits).
+func combineNumbers(a, b any, multiply bool) any {
+	x, xIsInt := toInt(a)
+	y, yIsInt := toInt(b)
+	if !xIsInt || !yIsInt {
+		fx, _ := toFloat(a)
+		fy, _ := toFloat(b)
+		if multiply {
+			return fx * fy
+		}
+		return fx + fy
+	}
+
+	result := x + y
+	if multiply {
+		result = x * y
+	}
+	_, aIs32 := a.(int32)
+	_, bIs32 := b.(int32)
+	if aIs32 && bIs32 && result >= math.MinInt32 && result <= math.MaxInt32 {
+		return int32(result)
+	}
+	return result
+}
+
+// zeroOf returns the zero of the type of a numeric value.
+func zeroOf(value any) any {
+	switch value.(type) {
+	case int32:
+		return int32(0)
+	case int64:
+		return int64(0)
+	case float64:
+		return float64(0)
+	default:
+		return 0
+	}
+}
+
+// toTime converts a date-like value (a BSON date-time, a time, or a
+// string in the date-time formats or in RFC 3339) to a time.
+func toTime(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case primitive.DateTime:
+		return v.Time(), true
+	case formats.DateTime:
+		return primitive.DateTime(v).Time(), true
+	case time.Time:
+		return v, true
+	case string:
+		var dateTime formats.DateTime
+		if encoded, err := json.Marshal(v); err == nil && dateTime.UnmarshalJSON(encoded) == nil {
+			return primitive.DateTime(dateTime).Time(), true
+		} else if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// compareValues compares two values of comparable types: numbers,
+// strings and dates. It tells whether they are comparable.
+func compareValues(a, b any) (int, bool) {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			if x < y {
+				return -1, true
+			} else if x > y {
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+	_, aIsString := a.(string)
+	_, bIsString := b.(string)
+	if aIsString && bIsString {
+		return strings.Compare(a.(string), b.(string)), true
+	}
+	if x, ok := toTime(a); ok {
+		if y, ok := toTime(b); ok {
+			return x.Compare(y), true
+		}
+	}
+	return 0, false
+}
+
+// valuesEqual tells whether two (normalized) values are equal. Numbers
+// are compared by their value, regardless their type.
+func valuesEqual(a, b any) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			if other, ok := y[key]; !ok || !valuesEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for index := range x {
+			if !valuesEqual(x[index], y[index]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+// eachValue returns the values to add in a $push or $addToSet
+// operation: the ones in $each, or the value itself.
+func eachValue(value any) []any {
+	if modifiers, ok := isModifierDoc(value); ok {
+		return modifiers["$each"].([]any)
+	}
+	return []any{value}
+}
+
+// pullMatches tells whether an array element must be removed in
+// a $pull operation.
+func pullMatches(element, value any) bool {
+	if modifiers, ok := isModifierDoc(value); ok {
+		if in, ok := modifiers["$in"]; ok {
+			for _, item := range in.([]any) {
+				if valuesEqual(element, item) {
+					return true
+				}
+			}
+			return false
+		}
+		return valuesEqual(element, modifiers["$eq"])
+	}
+	return valuesEqual(element, value)
+}
+
+// applyPatch applies the (already parsed) operations of a patch to a
+// (normalized) document. The errors are keyed by operator and path.
+func applyPatch(document map[string]any, operations []PatchOperation) map[string][]string {
+	errors := map[string][]string{}
+	for _, operation := range operations {
+		key := operation.Operator + "." + operation.Path
+		current, found := lookupPath(document, operation.Path)
+		var err error
+
+		switch operation.Operator {
+		case "$set":
+			err = setPath(document, operation.Path, operation.Value)
+		case "$unset":
+			unsetPath(document, operation.Path)
+		case "$inc", "$mul":
+			multiply := operation.Operator == "$mul"
+			if !found {
+				// Missing fields count as a zero of the argument's type.
+				err = setPath(document, operation.Path, combineNumbers(zeroOf(operation.Value), operation.Value, multiply))
+			} else if _, ok := toFloat(current); !ok {
+				addQueryError(errors, key, "type")
+			} else {
+				err = setPath(document, operation.Path, combineNumbers(current, operation.Value, multiply))
+			}
+		case "$min", "$max":
+			if !found {
+				err = setPath(document, operation.Path, operation.Value)
+			} else if cmp, ok := compareValues(operation.Value, current); !ok {
+				addQueryError(errors, key, "type")
+			} else if (operation.Operator == "$min" && cmp < 0) || (operation.Operator == "$max" && cmp > 0) {
+				err = setPath(document, operation.Path, operation.Value)
+			}
+		case "$push", "$addToSet":
+			if !found {
+				current = []any{}
+			}
+			if array, ok := current.([]any); !ok {
+				addQueryError(errors, key, "type")
+			} else {
+				for _, item := range eachValue(operation.Value) {
+					contained := false
+					if operation.Operator == "$addToSet" {
+						for _, element := range array {
+							if valuesEqual(element, item) {
+								contained = true
+								break
+							}
+						}
+					}
+					if !contained {
+						array = append(array, item)
+					}
+				}
+				err = setPath(document, operation.Path, array)
+			}
+		case "$pull":
+			if !found {
+				continue
+			}
+			if array, ok := current.([]any); !ok {
+				addQueryError(errors, key, "type")
+			} else {
+				kept := []any{}
+				for _, element := range array {
+					if !pullMatches(element, operation.Value) {
+						kept = append(kept, element)
+					}
+				}
+				err = setPath(document, operation.Path, kept)
+			}
+		case "$rename":
+			if found {
+				unsetPath(document, operation.Path)
+				err = setPath(document, operation.Value.(string), current)
+			}
+		default:
+			var failed bool
+			if failed, err = applyJSONPatchOperation(document, operation); failed {
+				addQueryError(errors, key, "test")
+			}
+		}
+
+		if err != nil {
+			addQueryError(errors, key, "path")
+		}
+	}
+	return errors
+}
+
+// makePatch makes a function that applies the operations of a patch
+// to a raw document, in memory, and converts the result to a new
+// instance of the model type (which must be validated before it is
+// stored). The document's _id is not part of the result. When the
+// patched document does not fit the model type, the error is keyed
+// by "document".
+func makePatch(make func() any) PatchFunc {
+	return func(original bson.Raw, operations []PatchOperation) (any, map[string][]string, error) {
+		var decoded bson.D
+		if err := bson.Unmarshal(original, &decoded); err != nil {
+			return nil, nil, err
+		}
+		document := normalizePatchValue(decoded).(map[string]any)
+		if errors := applyPatch(document, operations); len(errors) != 0 {
+			return nil, errors, nil
+		}
+		delete(document, "_id")
+
+		obj := make()
+		if raw, err := bson.Marshal(document); err != nil {
+			return nil, nil, err
+		} else if err := bson.Unmarshal(raw, obj); err != nil {
+			return nil, map[string][]string{"document": {"type"}}, nil
+		}
+		return obj, nil, nil
+	}
+}
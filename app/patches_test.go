@@ -0,0 +1,387 @@
+package app
+
+import (
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPatchOperators(t *testing.T) {
+	date := primitive.NewDateTimeFromTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	cases := []struct {
+		name     string
+		document map[string]any
+		patch    map[string]any
+		expected map[string]any
+		errors   map[string][]string
+	}{
+		{
+			name:     "$set creates the intermediate documents",
+			document: map[string]any{},
+			patch:    map[string]any{"$set": map[string]any{"a.b": "x"}},
+			expected: map[string]any{"a": map[string]any{"b": "x"}},
+		},
+		{
+			name:     "$set replaces an array element",
+			document: map[string]any{"tags": []any{"x", "y"}},
+			patch:    map[string]any{"$set": map[string]any{"tags.1": "z"}},
+			expected: map[string]any{"tags": []any{"x", "z"}},
+		},
+		{
+			name:     "$set appends right after the last array element",
+			document: map[string]any{"tags": []any{"x", "y"}},
+			patch:    map[string]any{"$set": map[string]any{"tags.2": "z"}},
+			expected: map[string]any{"tags": []any{"x", "y", "z"}},
+		},
+		{
+			name:     "$set does not pad arrays",
+			document: map[string]any{"tags": []any{"x", "y"}},
+			patch:    map[string]any{"$set": map[string]any{"tags.100000000000": "z"}},
+			errors:   map[string][]string{"$set.tags.100000000000": {"path"}},
+		},
+		{
+			name:     "$set does not traverse scalars",
+			document: map[string]any{"a": "x"},
+			patch:    map[string]any{"$set": map[string]any{"a.b": "y"}},
+			errors:   map[string][]string{"$set.a.b": {"path"}},
+		},
+		{
+			name:     "$unset removes a field",
+			document: map[string]any{"a": map[string]any{"b": "x", "c": "y"}},
+			patch:    map[string]any{"$unset": map[string]any{"a.b": ""}},
+			expected: map[string]any{"a": map[string]any{"c": "y"}},
+		},
+		{
+			name:     "$unset sets array elements to null",
+			document: map[string]any{"tags": []any{"x", "y"}},
+			patch:    map[string]any{"$unset": map[string]any{"tags.0": ""}},
+			expected: map[string]any{"tags": []any{nil, "y"}},
+		},
+		{
+			name:     "$unset ignores missing paths",
+			document: map[string]any{"tags": []any{"x"}},
+			patch:    map[string]any{"$unset": map[string]any{"tags.5": "", "a.b": ""}},
+			expected: map[string]any{"tags": []any{"x"}},
+		},
+		{
+			name:     "$inc keeps 32 bits integers",
+			document: map[string]any{"n": int32(1)},
+			patch:    map[string]any{"$inc": map[string]any{"n": int32(2)}},
+			expected: map[string]any{"n": int32(3)},
+		},
+		{
+			name:     "$inc widens 32 bits integers on overflow",
+			document: map[string]any{"n": int32(math.MaxInt32)},
+			patch:    map[string]any{"$inc": map[string]any{"n": int32(1)}},
+			expected: map[string]any{"n": int64(math.MaxInt32 + 1)},
+		},
+		{
+			name:     "$inc keeps 64 bits integers",
+			document: map[string]any{"n": int64(1)},
+			patch:    map[string]any{"$inc": map[string]any{"n": int32(1)}},
+			expected: map[string]any{"n": int64(2)},
+		},
+		{
+			name:     "$inc with a double yields a double",
+			document: map[string]any{"n": int32(1)},
+			patch:    map[string]any{"$inc": map[string]any{"n": 0.5}},
+			expected: map[string]any{"n": 1.5},
+		},
+		{
+			name:     "$inc sets missing fields with the argument's type",
+			document: map[string]any{},
+			patch:    map[string]any{"$inc": map[string]any{"n": int32(5)}},
+			expected: map[string]any{"n": int32(5)},
+		},
+		{
+			name:     "$inc fails on non-numbers",
+			document: map[string]any{"n": "x"},
+			patch:    map[string]any{"$inc": map[string]any{"n": int32(1)}},
+			errors:   map[string][]string{"$inc.n": {"type"}},
+		},
+		{
+			name:     "$inc requires a numeric argument",
+			document: map[string]any{"n": int32(1)},
+			patch:    map[string]any{"$inc": map[string]any{"n": "1"}},
+			errors:   map[string][]string{"$inc.n": {"type"}},
+		},
+		{
+			name:     "$mul multiplies integers",
+			document: map[string]any{"n": int32(3)},
+			patch:    map[string]any{"$mul": map[string]any{"n": int32(4)}},
+			expected: map[string]any{"n": int32(12)},
+		},
+		{
+			name:     "$mul sets missing fields to zero",
+			document: map[string]any{},
+			patch:    map[string]any{"$mul": map[string]any{"n": 2.5}},
+			expected: map[string]any{"n": 0.0},
+		},
+		{
+			name:     "$min sets a lower value",
+			document: map[string]any{"n": int32(5)},
+			patch:    map[string]any{"$min": map[string]any{"n": 3.0}},
+			expected: map[string]any{"n": 3.0},
+		},
+		{
+			name:     "$min keeps the current lower value",
+			document: map[string]any{"n": int32(3)},
+			patch:    map[string]any{"$min": map[string]any{"n": 5.0}},
+			expected: map[string]any{"n": int32(3)},
+		},
+		{
+			name:     "$max compares numbers of different types",
+			document: map[string]any{"n": int64(5)},
+			patch:    map[string]any{"$max": map[string]any{"n": 5.5}},
+			expected: map[string]any{"n": 5.5},
+		},
+		{
+			name:     "$max sets missing fields",
+			document: map[string]any{},
+			patch:    map[string]any{"$max": map[string]any{"s": "b"}},
+			expected: map[string]any{"s": "b"},
+		},
+		{
+			name:     "$max compares strings",
+			document: map[string]any{"s": "b"},
+			patch:    map[string]any{"$max": map[string]any{"s": "a"}},
+			expected: map[string]any{"s": "b"},
+		},
+		{
+			name:     "$max compares dates with date strings",
+			document: map[string]any{"d": date},
+			patch:    map[string]any{"$max": map[string]any{"d": "2021-01-01T00:00:00"}},
+			expected: map[string]any{"d": "2021-01-01T00:00:00"},
+		},
+		{
+			name:     "$min compares dates with RFC 3339 strings",
+			document: map[string]any{"d": date},
+			patch:    map[string]any{"$min": map[string]any{"d": "2021-01-01T00:00:00Z"}},
+			expected: map[string]any{"d": date},
+		},
+		{
+			name:     "$min fails on values of different types",
+			document: map[string]any{"n": int32(5)},
+			patch:    map[string]any{"$min": map[string]any{"n": "3"}},
+			errors:   map[string][]string{"$min.n": {"type"}},
+		},
+		{
+			name:     "$push appends a value",
+			document: map[string]any{"tags": []any{"x"}},
+			patch:    map[string]any{"$push": map[string]any{"tags": "x"}},
+			expected: map[string]any{"tags": []any{"x", "x"}},
+		},
+		{
+			name:     "$push appends each value",
+			document: map[string]any{},
+			patch:    map[string]any{"$push": map[string]any{"tags": map[string]any{"$each": []any{"x", "y"}}}},
+			expected: map[string]any{"tags": []any{"x", "y"}},
+		},
+		{
+			name:     "$push fails on non-arrays",
+			document: map[string]any{"tags": "x"},
+			patch:    map[string]any{"$push": map[string]any{"tags": "y"}},
+			errors:   map[string][]string{"$push.tags": {"type"}},
+		},
+		{
+			name:     "$push only allows the $each modifier",
+			document: map[string]any{},
+			patch:    map[string]any{"$push": map[string]any{"tags": map[string]any{"$slice": 1}}},
+			errors:   map[string][]string{"$push.tags": {"modifier"}},
+		},
+		{
+			name:     "$addToSet skips the contained values",
+			document: map[string]any{"n": []any{int32(1)}},
+			patch:    map[string]any{"$addToSet": map[string]any{"n": map[string]any{"$each": []any{1.0, 2.0, 2.0}}}},
+			expected: map[string]any{"n": []any{int32(1), 2.0}},
+		},
+		{
+			name:     "$pull removes the equal values",
+			document: map[string]any{"n": []any{int32(1), int32(2), int64(1)}},
+			patch:    map[string]any{"$pull": map[string]any{"n": 1.0}},
+			expected: map[string]any{"n": []any{int32(2)}},
+		},
+		{
+			name:     "$pull removes the values in $in",
+			document: map[string]any{"n": []any{"a", "b", "c"}},
+			patch:    map[string]any{"$pull": map[string]any{"n": map[string]any{"$in": []any{"a", "c", "d"}}}},
+			expected: map[string]any{"n": []any{"b"}},
+		},
+		{
+			name:     "$pull compares documents with $eq",
+			document: map[string]any{"n": []any{map[string]any{"a": "x"}, map[string]any{"a": "y"}}},
+			patch:    map[string]any{"$pull": map[string]any{"n": map[string]any{"$eq": map[string]any{"a": "x"}}}},
+			expected: map[string]any{"n": []any{map[string]any{"a": "y"}}},
+		},
+		{
+			name:     "$pull ignores missing fields",
+			document: map[string]any{},
+			patch:    map[string]any{"$pull": map[string]any{"n": "x"}},
+			expected: map[string]any{},
+		},
+		{
+			name:     "$pull only allows the $in and $eq modifiers",
+			document: map[string]any{"n": []any{}},
+			patch:    map[string]any{"$pull": map[string]any{"n": map[string]any{"$gt": 1}}},
+			errors:   map[string][]string{"$pull.n": {"modifier"}},
+		},
+		{
+			name:     "$rename moves a value",
+			document: map[string]any{"a": "x"},
+			patch:    map[string]any{"$rename": map[string]any{"a": "b.c"}},
+			expected: map[string]any{"b": map[string]any{"c": "x"}},
+		},
+		{
+			name:     "$rename ignores missing fields",
+			document: map[string]any{"b": "x"},
+			patch:    map[string]any{"$rename": map[string]any{"a": "c"}},
+			expected: map[string]any{"b": "x"},
+		},
+		{
+			name:     "$rename does not allow overlapping paths",
+			document: map[string]any{},
+			patch:    map[string]any{"$rename": map[string]any{"a": "a.b"}},
+			errors:   map[string][]string{"$rename.a": {"syntax"}},
+		},
+		{
+			name:     "paths must not conflict",
+			document: map[string]any{},
+			patch:    map[string]any{"$set": map[string]any{"a": "x"}, "$unset": map[string]any{"a.b": ""}},
+			errors:   map[string][]string{"$unset.a.b": {"conflict"}},
+		},
+		{
+			name:     "the _id cannot be written",
+			document: map[string]any{},
+			patch:    map[string]any{"$set": map[string]any{"_id": "x"}},
+			errors:   map[string][]string{"$set._id": {"immutable"}},
+		},
+		{
+			name:     "only the supported operators are allowed",
+			document: map[string]any{},
+			patch:    map[string]any{"$pop": map[string]any{"a": 1}, "a": "x"},
+			errors:   map[string][]string{"$pop": {"unsupported"}, "a": {"operator"}},
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			operations, errors := parsePatch(case_.patch)
+			if len(errors) == 0 {
+				errors = applyPatch(case_.document, operations)
+			}
+			if len(case_.errors) != 0 || len(errors) != 0 {
+				if !reflect.DeepEqual(errors, case_.errors) {
+					t.Fatalf("expected errors %v, got %v", case_.errors, errors)
+				}
+			} else if !reflect.DeepEqual(case_.document, case_.expected) {
+				t.Fatalf("expected %#v, got %#v", case_.expected, case_.document)
+			}
+		})
+	}
+}
+
+func TestMakePatch(t *testing.T) {
+	type model struct {
+		Name  string   `bson:"name"`
+		Count int32    `bson:"count"`
+		Tags  []string `bson:"tags"`
+	}
+	patch := makePatch(func() any { return &model{} })
+	original, _ := bson.Marshal(bson.M{"_id": primitive.NewObjectID(), "name": "x", "count": int32(1)})
+
+	result, errors, err := patch(original, []PatchOperation{
+		{Operator: "$inc", Path: "count", Value: 2.0},
+		{Operator: "$push", Path: "tags", Value: "y"},
+	})
+	if err != nil || len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v, %v", errors, err)
+	}
+	if expected := (&model{Name: "x", Count: 3, Tags: []string{"y"}}); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, result)
+	}
+
+	_, errors, err = patch(original, []PatchOperation{{Operator: "$set", Path: "count", Value: "x"}})
+	if err != nil || !reflect.DeepEqual(errors, map[string][]string{"document": {"type"}}) {
+		t.Fatalf("expected a document type error, got %v, %v", errors, err)
+	}
+}
+
+func TestPatchPolicy(t *testing.T) {
+	type model struct {
+		Name   string `bson:"name"`
+		Code   string `bson:"code"`
+		Secret string `bson:"secret"`
+	}
+	check := makePatchPolicy(nil, makeModelFields(model{}), nil, []string{"code"}, []string{"secret"})
+	cases := []struct {
+		name      string
+		operation PatchOperation
+		errors    map[string][]string
+	}{
+		{"sets a field", PatchOperation{Operator: "$set", Path: "name", Value: "x"}, nil},
+		{"sets a write-only field", PatchOperation{Operator: "$set", Path: "secret", Value: "x"}, nil},
+		{
+			"forbids a protected field", PatchOperation{Operator: "$set", Path: "code", Value: "x"},
+			map[string][]string{"$set.code": {"forbidden"}},
+		},
+		{"tests a field", PatchOperation{Operator: "test", Path: "name", Value: "x"}, nil},
+		{
+			"forbids testing a write-only field", PatchOperation{Operator: "test", Path: "secret", Value: "x"},
+			map[string][]string{"test.secret": {"write-only"}},
+		},
+		{
+			"forbids copying a write-only field", PatchOperation{Operator: "copy", Path: "name", From: "secret"},
+			map[string][]string{"copy.name": {"write-only"}},
+		},
+		{
+			"forbids moving a write-only field", PatchOperation{Operator: "move", Path: "name", From: "secret"},
+			map[string][]string{"move.name": {"write-only"}},
+		},
+		{
+			"forbids renaming a write-only field", PatchOperation{Operator: "$rename", Path: "secret", Value: "name"},
+			map[string][]string{"$rename.secret": {"write-only"}},
+		},
+		{"renames a field into a write-only one", PatchOperation{Operator: "$rename", Path: "name", Value: "secret"}, nil},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			errors := check([]PatchOperation{case_.operation})
+			if len(errors) != 0 || len(case_.errors) != 0 {
+				if !reflect.DeepEqual(errors, case_.errors) {
+					t.Fatalf("expected errors %v, got %v", case_.errors, errors)
+				}
+			}
+		})
+	}
+}
+
+func TestPatchPolicyInputType(t *testing.T) {
+	type model struct {
+		Name     string `bson:"name"`
+		Internal string `bson:"internal"`
+	}
+	type input struct {
+		Name string `bson:"name"`
+	}
+	check := makePatchPolicy(nil, makeModelFields(model{}), makeModelFields(input{}), nil, nil)
+	if errors := check([]PatchOperation{{Operator: "$set", Path: "name", Value: "x"}}); len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+	errors := check([]PatchOperation{{Operator: "$set", Path: "internal", Value: "x"}})
+	if expected := map[string][]string{"$set.internal": {"forbidden"}}; !reflect.DeepEqual(errors, expected) {
+		t.Fatalf("expected errors %v, got %v", expected, errors)
+	}
+
+	// An explicit policy can still allow the fields of the model.
+	check = makePatchPolicy(
+		&dsl.PatchPolicy{Paths: []string{"internal"}}, makeModelFields(model{}), makeModelFields(input{}), nil, nil,
+	)
+	if errors := check([]PatchOperation{{Operator: "$set", Path: "internal", Value: "x"}}); len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+}
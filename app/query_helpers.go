@@ -0,0 +1,389 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/formats"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/responses"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	rxFilterParam = regexp.MustCompile(`^filter\[([^\[\]]+)](?:\[([^\[\]]+)])?$`)
+)
+
+// FilterParserFunc stands for a function that parses the filter
+// criteria in the query string, given the client's request.
+type FilterParserFunc func(echo.Context) (bson.M, bool, error)
+
+// SortParserFunc stands for a function that parses the sort criteria
+// in the query string, given the client's request. It returns a nil
+// criteria when the client did not specify any.
+type SortParserFunc func(echo.Context) (bson.D, bool, error)
+
+// FieldsParserFunc stands for a function that parses the fields to
+// retrieve, given the client's request. It returns nil fields when the
+// client did not specify any.
+type FieldsParserFunc func(echo.Context) ([]string, bool, error)
+
+// GeoQuery stands for the client-provided geospatial criteria: the
+// filter and whether it is a proximity ($near) one.
+type GeoQuery struct {
+	Filter bson.M
+	Near   bool
+}
+
+// GeoParserFunc stands for a function that parses the geospatial
+// criteria in the query string, given the client's request. It
+// returns a nil query when the client did not specify any.
+type GeoParserFunc func(echo.Context) (*GeoQuery, bool, error)
+
+// addQueryError adds an error to a map of query errors.
+func addQueryError(errors map[string][]string, key, tag string) {
+	errors[key] = append(errors[key], tag)
+}
+
+// parseQueryValue converts a query string value into a value of the
+// given type (typically, the type of a field in the model). Strings
+// are taken verbatim, while other types are parsed as JSON (falling
+// back to a JSON string, which covers types like ObjectID or DateTime).
+func parseQueryValue(raw string, type_ reflect.Type) (any, error) {
+	for type_.Kind() == reflect.Pointer {
+		type_ = type_.Elem()
+	}
+	if type_.Kind() == reflect.Slice && type_.Elem().Kind() != reflect.Uint8 {
+		// Filtering on a slice field compares against its elements.
+		type_ = type_.Elem()
+		for type_.Kind() == reflect.Pointer {
+			type_ = type_.Elem()
+		}
+	}
+
+	value := reflect.New(type_)
+	if type_.Kind() == reflect.String {
+		value.Elem().SetString(raw)
+	} else if err := json.Unmarshal([]byte(raw), value.Interface()); err != nil {
+		if quoted, err := json.Marshal(raw); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal(quoted, value.Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return value.Interface(), nil
+}
+
+// makeFilterParser makes a function that parses the filter criteria
+// given by the clients as query string parameters, in the format:
+// filter[field]=value (which stands for equality) or, otherwise,
+// filter[field][op]=value. Only the fields and operators declared
+// as filterable are allowed, and the values are parsed according
+// to the types of the respective fields in the model.
+func makeFilterParser(filterable dsl.Filterable, modelFields map[string]reflect.Type) FilterParserFunc {
+	fieldTypes := map[string]reflect.Type{}
+	for field := range filterable {
+		if field == "_id" {
+			fieldTypes[field] = reflect.TypeOf(primitive.NilObjectID)
+		} else if type_, ok := modelFields[field]; ok {
+			fieldTypes[field] = type_
+		} else {
+			panic("the filterable field is not mapped in the model: " + field)
+		}
+	}
+
+	return func(ctx echo.Context) (bson.M, bool, error) {
+		filter := bson.M{}
+		errors := map[string][]string{}
+		for param, values := range ctx.QueryParams() {
+			if !strings.HasPrefix(param, "filter") {
+				continue
+			}
+			match := rxFilterParam.FindStringSubmatch(param)
+			if match == nil {
+				addQueryError(errors, param, "syntax")
+				continue
+			}
+			field, operator := match[1], dsl.FilterOperator(match[2])
+			key := "filter." + field
+			if operator == "" {
+				operator = dsl.FilterEq
+			}
+
+			// Check the field and operator to be allowed.
+			operators, ok := filterable[field]
+			if !ok {
+				addQueryError(errors, key, "filterable")
+				continue
+			}
+			allowed := false
+			for _, allowedOperator := range operators {
+				if allowedOperator == operator {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				addQueryError(errors, key, "operator")
+				continue
+			}
+			if len(values) != 1 {
+				addQueryError(errors, key, "unique")
+				continue
+			}
+
+			// Parse the value(s) according to the operator.
+			var value any
+			var err error
+			switch operator {
+			case dsl.FilterExists:
+				value, err = strconv.ParseBool(values[0])
+			case dsl.FilterIn, dsl.FilterNin:
+				items := bson.A{}
+				for _, item := range strings.Split(values[0], ",") {
+					var parsed any
+					if parsed, err = parseQueryValue(item, fieldTypes[field]); err != nil {
+						break
+					}
+					items = append(items, parsed)
+				}
+				value = items
+			default:
+				value, err = parseQueryValue(values[0], fieldTypes[field])
+			}
+			if err != nil {
+				addQueryError(errors, key, "value")
+				continue
+			}
+
+			// Add the condition to the field's criteria.
+			conditions, ok := filter[field].(bson.M)
+			if !ok {
+				conditions = bson.M{}
+				filter[field] = conditions
+			}
+			conditions["$"+string(operator)] = value
+		}
+
+		if len(errors) != 0 {
+			return nil, false, responses.InvalidQuery(ctx, errors)
+		}
+		return filter, true, nil
+	}
+}
+
+// textScoreSortKey is the sort key the clients use to sort by the
+// relevance of the elements in a full-text search.
+const textScoreSortKey = "~score"
+
+// textScoreSort is the sort entry for the relevance of the elements
+// in a full-text search.
+var textScoreSort = bson.E{Key: "_score", Value: bson.M{"$meta": "textScore"}}
+
+// makeSortParser makes a function that parses the sort criteria given
+// by the clients in the "sort" query string parameter, in the format:
+// sort=field1,-field2 (the - prefix stands for descending order). Only
+// the fields declared as sortable are allowed, and also ~score (which
+// stands for the relevance) when performing a full-text search.
+func makeSortParser(sortable []string, modelFields map[string]reflect.Type) SortParserFunc {
+	allowed := map[string]bool{}
+	for _, field := range sortable {
+		if _, ok := modelFields[field]; !ok && field != "_id" {
+			panic("the sortable field is not mapped in the model: " + field)
+		}
+		allowed[field] = true
+	}
+
+	return func(ctx echo.Context) (bson.D, bool, error) {
+		param := strings.TrimSpace(ctx.QueryParam("sort"))
+		if param == "" {
+			return nil, true, nil
+		}
+
+		sort := bson.D{}
+		used := map[string]bool{}
+		errors := map[string][]string{}
+		for _, token := range strings.Split(param, ",") {
+			token = strings.TrimSpace(token)
+			direction := 1
+			if strings.HasPrefix(token, "-") {
+				token, direction = token[1:], -1
+			}
+			if token == "" {
+				addQueryError(errors, "sort", "syntax")
+			} else if token == textScoreSortKey {
+				if strings.TrimSpace(ctx.QueryParam("q")) == "" {
+					addQueryError(errors, "sort."+token, "search")
+				} else if used[token] {
+					addQueryError(errors, "sort."+token, "unique")
+				} else {
+					used[token] = true
+					sort = append(sort, textScoreSort)
+				}
+			} else if !allowed[token] {
+				addQueryError(errors, "sort."+token, "sortable")
+			} else if used[token] {
+				addQueryError(errors, "sort."+token, "unique")
+			} else {
+				used[token] = true
+				sort = append(sort, bson.E{Key: token, Value: direction})
+			}
+		}
+
+		if len(errors) != 0 {
+			return nil, false, responses.InvalidQuery(ctx, errors)
+		}
+		return sort, true, nil
+	}
+}
+
+// makeFieldsParser makes a function that parses the fields given by the
+// clients in the "fields" query string parameter, in the format:
+// fields=field1,field2. Only the fields mapped in the model are allowed.
+func makeFieldsParser(modelFields map[string]reflect.Type) FieldsParserFunc {
+	return func(ctx echo.Context) ([]string, bool, error) {
+		param := strings.TrimSpace(ctx.QueryParam("fields"))
+		if param == "" {
+			return nil, true, nil
+		}
+
+		var fields []string
+		errors := map[string][]string{}
+		for _, field := range strings.Split(param, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				addQueryError(errors, "fields", "syntax")
+			} else if _, ok := modelFields[field]; !ok && field != "_id" {
+				addQueryError(errors, "fields."+field, "field")
+			} else {
+				fields = append(fields, field)
+			}
+		}
+
+		if len(errors) != 0 {
+			return nil, false, responses.InvalidQuery(ctx, errors)
+		}
+		return fields, true, nil
+	}
+}
+
+// parseGeoPoints parses a list of comma-separated (longitude, latitude)
+// pairs, ensuring the coordinates are in range.
+func parseGeoPoints(raw string, count int) ([]formats.GeoPoint, bool) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != count*2 {
+		return nil, false
+	}
+	points := make([]formats.GeoPoint, count)
+	for index := range points {
+		if longitude, err := strconv.ParseFloat(strings.TrimSpace(parts[index*2]), 64); err != nil {
+			return nil, false
+		} else if latitude, err := strconv.ParseFloat(strings.TrimSpace(parts[index*2+1]), 64); err != nil {
+			return nil, false
+		} else if !formats.ValidCoordinates(longitude, latitude) {
+			return nil, false
+		} else {
+			points[index] = formats.GeoPoint{Longitude: longitude, Latitude: latitude}
+		}
+	}
+	return points, true
+}
+
+// makeGeoParser makes a function that parses the geospatial criteria
+// given by the clients as query string parameters, in one of these
+// formats (only one of them can be used at once):
+// - near=lng,lat (optionally, max_distance=meters and min_distance=meters).
+// - box=lng1,lat1,lng2,lat2 (the bottom-left and top-right corners).
+// - within={GeoJSON polygon}.
+// The criteria apply to the given geo_field=field, which can be omitted
+// when there is only one field indexed as 2dsphere.
+func makeGeoParser(geoFields []string) GeoParserFunc {
+	return func(ctx echo.Context) (*GeoQuery, bool, error) {
+		params := ctx.QueryParams()
+		modes := 0
+		for _, param := range []string{"near", "box", "within"} {
+			if params.Has(param) {
+				modes++
+			}
+		}
+		if modes == 0 {
+			for _, param := range []string{"geo_field", "max_distance", "min_distance"} {
+				if params.Has(param) {
+					return nil, false, responses.InvalidQuery(ctx, map[string][]string{param: {"geo"}})
+				}
+			}
+			return nil, true, nil
+		}
+
+		errors := map[string][]string{}
+		if len(geoFields) == 0 {
+			addQueryError(errors, "geo", "unsupported")
+		} else if modes > 1 {
+			addQueryError(errors, "geo", "unique")
+		}
+		field := ctx.QueryParam("geo_field")
+		if field == "" && len(geoFields) == 1 {
+			field = geoFields[0]
+		}
+		found := false
+		for _, geoField := range geoFields {
+			if geoField == field {
+				found = true
+				break
+			}
+		}
+		if len(geoFields) != 0 && !found {
+			addQueryError(errors, "geo_field", "geo")
+		}
+		if len(errors) != 0 {
+			return nil, false, responses.InvalidQuery(ctx, errors)
+		}
+
+		var query *GeoQuery
+		if params.Has("near") {
+			near := bson.M{}
+			if points, ok := parseGeoPoints(params.Get("near"), 1); !ok {
+				addQueryError(errors, "near", "point")
+			} else {
+				near["$geometry"] = points[0]
+			}
+			for param, operator := range map[string]string{"max_distance": "$maxDistance", "min_distance": "$minDistance"} {
+				if params.Has(param) {
+					if distance, err := strconv.ParseFloat(params.Get(param), 64); err != nil || distance < 0 {
+						addQueryError(errors, param, "distance")
+					} else {
+						near[operator] = distance
+					}
+				}
+			}
+			query = &GeoQuery{Filter: bson.M{field: bson.M{"$near": near}}, Near: true}
+		} else {
+			var polygon formats.GeoPolygon
+			if params.Has("box") {
+				if points, ok := parseGeoPoints(params.Get("box"), 2); !ok ||
+					points[0].Longitude >= points[1].Longitude || points[0].Latitude >= points[1].Latitude {
+					addQueryError(errors, "box", "box")
+				} else {
+					polygon = formats.NewGeoBox(points[0], points[1])
+				}
+			} else if err := json.Unmarshal([]byte(params.Get("within")), &polygon); err != nil {
+				addQueryError(errors, "within", "polygon")
+			}
+			for _, param := range []string{"max_distance", "min_distance"} {
+				if params.Has(param) {
+					addQueryError(errors, param, "near")
+				}
+			}
+			query = &GeoQuery{Filter: bson.M{field: bson.M{"$geoWithin": bson.M{"$geometry": polygon}}}}
+		}
+
+		if len(errors) != 0 {
+			return nil, false, responses.InvalidQuery(ctx, errors)
+		}
+		return query, true, nil
+	}
+}
@@ -0,0 +1,335 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/formats"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// newTestContext makes a context for a request to the given target,
+// recording the response.
+func newTestContext(method, target string, header map[string]string) (echo.Context, *httptest.ResponseRecorder) {
+	request := httptest.NewRequest(method, target, nil)
+	for key, value := range header {
+		request.Header.Set(key, value)
+	}
+	recorder := httptest.NewRecorder()
+	return echo.New().NewContext(request, recorder), recorder
+}
+
+// responseErrors decodes the errors of a rendered response, failing the
+// test if it is not a 400 "query:invalid" one.
+func responseErrors(t *testing.T, recorder *httptest.ResponseRecorder) map[string][]string {
+	t.Helper()
+	var body struct {
+		Code   string              `json:"code"`
+		Errors map[string][]string `json:"errors"`
+	}
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", recorder.Code)
+	} else if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body.Code != "query:invalid" {
+		t.Fatalf("expected a query:invalid response, got %s", recorder.Body.String())
+	}
+	return body.Errors
+}
+
+// queryModel is the model type used to test the query string parsers.
+type queryModel struct {
+	Name  string             `bson:"name"`
+	Age   int                `bson:"age"`
+	Tags  []string           `bson:"tags"`
+	Owner primitive.ObjectID `bson:"owner"`
+	Score *float64           `bson:"score"`
+}
+
+func TestParseQueryValue(t *testing.T) {
+	id := primitive.NewObjectID()
+	cases := []struct {
+		name     string
+		raw      string
+		type_    reflect.Type
+		expected any
+		fails    bool
+	}{
+		{"takes strings verbatim", `"x"`, reflect.TypeOf(""), `"x"`, false},
+		{"parses integers", "12", reflect.TypeOf(0), 12, false},
+		{"rejects invalid integers", "x", reflect.TypeOf(0), nil, true},
+		{"parses booleans", "true", reflect.TypeOf(false), true, false},
+		{"parses pointed types", "1.5", reflect.TypeOf(new(float64)), 1.5, false},
+		{"parses slice elements", "a", reflect.TypeOf([]string{}), "a", false},
+		{"parses object ids as strings", id.Hex(), reflect.TypeOf(id), id, false},
+		{"rejects invalid object ids", "x", reflect.TypeOf(id), nil, true},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			value, err := parseQueryValue(case_.raw, case_.type_)
+			if case_.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", value)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if actual := reflect.ValueOf(value).Elem().Interface(); !reflect.DeepEqual(actual, case_.expected) {
+				t.Fatalf("expected %#v, got %#v", case_.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFilterParser(t *testing.T) {
+	parse := makeFilterParser(dsl.Filterable{
+		"name":  {dsl.FilterEq, dsl.FilterIn},
+		"age":   {dsl.FilterGte, dsl.FilterLt},
+		"tags":  {dsl.FilterEq},
+		"score": {dsl.FilterExists},
+		"_id":   {dsl.FilterEq},
+	}, makeModelFields(queryModel{}))
+	id := primitive.NewObjectID()
+	age, minAge, maxAge, name, tag := 0, 18, 65, "x", "a"
+	names := []string{"x", "y"}
+
+	cases := []struct {
+		name     string
+		query    string
+		expected bson.M
+		errors   map[string][]string
+	}{
+		{"ignores other parameters", "page=1", bson.M{}, nil},
+		{"parses equalities", "filter[name]=x", bson.M{"name": bson.M{"$eq": &name}}, nil},
+		{"parses explicit operators", "filter[name][eq]=x", bson.M{"name": bson.M{"$eq": &name}}, nil},
+		{
+			"combines operators on a field", "filter[age][gte]=18&filter[age][lt]=65",
+			bson.M{"age": bson.M{"$gte": &minAge, "$lt": &maxAge}}, nil,
+		},
+		{"parses lists", "filter[name][in]=x,y", bson.M{"name": bson.M{"$in": bson.A{&names[0], &names[1]}}}, nil},
+		{"parses the elements of slices", "filter[tags]=a", bson.M{"tags": bson.M{"$eq": &tag}}, nil},
+		{"parses existence", "filter[score][exists]=false", bson.M{"score": bson.M{"$exists": false}}, nil},
+		{"parses object ids", "filter[_id]=" + id.Hex(), bson.M{"_id": bson.M{"$eq": &id}}, nil},
+		{"parses zero values", "filter[age][gte]=0", bson.M{"age": bson.M{"$gte": &age}}, nil},
+		{"rejects bad syntax", "filter[name=x", nil, map[string][]string{"filter[name": {"syntax"}}},
+		{"rejects fields not filterable", "filter[owner]=x", nil, map[string][]string{"filter.owner": {"filterable"}}},
+		{"rejects operators not allowed", "filter[age]=1", nil, map[string][]string{"filter.age": {"operator"}}},
+		{"rejects unknown operators", "filter[name][regex]=x", nil, map[string][]string{"filter.name": {"operator"}}},
+		{"rejects repeated parameters", "filter[name]=x&filter[name]=y", nil, map[string][]string{"filter.name": {"unique"}}},
+		{"rejects invalid values", "filter[age][gte]=x", nil, map[string][]string{"filter.age": {"value"}}},
+		{"rejects invalid object ids", "filter[_id]=x", nil, map[string][]string{"filter._id": {"value"}}},
+		{"rejects invalid existence", "filter[score][exists]=x", nil, map[string][]string{"filter.score": {"value"}}},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			ctx, recorder := newTestContext(http.MethodGet, "/?"+case_.query, nil)
+			filter, ok, err := parse(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if case_.errors != nil {
+				if ok {
+					t.Fatalf("expected errors %v, got the filter %v", case_.errors, filter)
+				} else if errors := responseErrors(t, recorder); !reflect.DeepEqual(errors, case_.errors) {
+					t.Fatalf("expected errors %v, got %v", case_.errors, errors)
+				}
+			} else if !ok {
+				t.Fatalf("unexpected errors: %s", recorder.Body.String())
+			} else if !reflect.DeepEqual(filter, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, filter)
+			}
+		})
+	}
+}
+
+func TestFilterParserUnmappedField(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected a panic")
+		}
+	}()
+	makeFilterParser(dsl.Filterable{"missing": {dsl.FilterEq}}, makeModelFields(queryModel{}))
+}
+
+func TestSortParser(t *testing.T) {
+	parse := makeSortParser([]string{"name", "age", "_id"}, makeModelFields(queryModel{}))
+	cases := []struct {
+		name     string
+		query    string
+		expected bson.D
+		errors   map[string][]string
+	}{
+		{"tells no criteria", "", nil, nil},
+		{"parses ascending fields", "sort=name", bson.D{{Key: "name", Value: 1}}, nil},
+		{
+			"parses descending fields", "sort=-age,_id",
+			bson.D{{Key: "age", Value: -1}, {Key: "_id", Value: 1}}, nil,
+		},
+		{"trims the fields", "sort=%20name%20", bson.D{{Key: "name", Value: 1}}, nil},
+		{"rejects empty fields", "sort=name,,age", nil, map[string][]string{"sort": {"syntax"}}},
+		{"rejects fields not sortable", "sort=tags", nil, map[string][]string{"sort.tags": {"sortable"}}},
+		{"rejects repeated fields", "sort=name,-name", nil, map[string][]string{"sort.name": {"unique"}}},
+		{"sorts by relevance when searching", "q=x&sort=~score", bson.D{textScoreSort}, nil},
+		{"rejects relevance without searching", "sort=~score", nil, map[string][]string{"sort.~score": {"search"}}},
+		{"rejects repeated relevance", "q=x&sort=~score,-~score", nil, map[string][]string{"sort.~score": {"unique"}}},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			ctx, recorder := newTestContext(http.MethodGet, "/?"+case_.query, nil)
+			sort, ok, err := parse(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if case_.errors != nil {
+				if ok {
+					t.Fatalf("expected errors %v, got the sort %v", case_.errors, sort)
+				} else if errors := responseErrors(t, recorder); !reflect.DeepEqual(errors, case_.errors) {
+					t.Fatalf("expected errors %v, got %v", case_.errors, errors)
+				}
+			} else if !ok {
+				t.Fatalf("unexpected errors: %s", recorder.Body.String())
+			} else if !reflect.DeepEqual(sort, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, sort)
+			}
+		})
+	}
+}
+
+func TestFieldsParser(t *testing.T) {
+	parse := makeFieldsParser(makeModelFields(queryModel{}))
+	cases := []struct {
+		name     string
+		query    string
+		expected []string
+		errors   map[string][]string
+	}{
+		{"tells no fields", "fields=%20", nil, nil},
+		{"parses fields", "fields=name,%20_id", []string{"name", "_id"}, nil},
+		{"rejects empty fields", "fields=name,", nil, map[string][]string{"fields": {"syntax"}}},
+		{"rejects unknown fields", "fields=name,other", nil, map[string][]string{"fields.other": {"field"}}},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			ctx, recorder := newTestContext(http.MethodGet, "/?"+case_.query, nil)
+			fields, ok, err := parse(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if case_.errors != nil {
+				if ok {
+					t.Fatalf("expected errors %v, got the fields %v", case_.errors, fields)
+				} else if errors := responseErrors(t, recorder); !reflect.DeepEqual(errors, case_.errors) {
+					t.Fatalf("expected errors %v, got %v", case_.errors, errors)
+				}
+			} else if !ok {
+				t.Fatalf("unexpected errors: %s", recorder.Body.String())
+			} else if !reflect.DeepEqual(fields, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, fields)
+			}
+		})
+	}
+}
+
+func TestParseGeoPoints(t *testing.T) {
+	cases := []struct {
+		name     string
+		raw      string
+		count    int
+		expected []formats.GeoPoint
+	}{
+		{"parses a point", "-58.4, -34.6", 1, []formats.GeoPoint{{Longitude: -58.4, Latitude: -34.6}}},
+		{
+			"parses many points", "1,2,3,4", 2,
+			[]formats.GeoPoint{{Longitude: 1, Latitude: 2}, {Longitude: 3, Latitude: 4}},
+		},
+		{"rejects fewer coordinates", "1,2", 2, nil},
+		{"rejects more coordinates", "1,2,3", 1, nil},
+		{"rejects invalid numbers", "1,x", 1, nil},
+		{"rejects longitudes out of range", "181,0", 1, nil},
+		{"rejects latitudes out of range", "0,-91", 1, nil},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			points, ok := parseGeoPoints(case_.raw, case_.count)
+			if ok != (case_.expected != nil) {
+				t.Fatalf("expected the points %v, got %v", case_.expected, points)
+			} else if ok && !reflect.DeepEqual(points, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, points)
+			}
+		})
+	}
+}
+
+func TestGeoParser(t *testing.T) {
+	point := formats.GeoPoint{Longitude: 1, Latitude: 2}
+	box := formats.NewGeoBox(formats.GeoPoint{Longitude: 0, Latitude: 0}, formats.GeoPoint{Longitude: 1, Latitude: 1})
+	within := url.QueryEscape(`{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1],[0,0]]]}`)
+	open := url.QueryEscape(`{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1]]]}`)
+	cases := []struct {
+		name      string
+		geoFields []string
+		query     string
+		expected  *GeoQuery
+		errors    map[string][]string
+	}{
+		{"tells no criteria", []string{"where"}, "", nil, nil},
+		{
+			"parses proximity", []string{"where"}, "near=1,2&max_distance=10&min_distance=0",
+			&GeoQuery{Filter: bson.M{"where": bson.M{"$near": bson.M{
+				"$geometry": point, "$maxDistance": 10.0, "$minDistance": 0.0,
+			}}}, Near: true}, nil,
+		},
+		{
+			"parses boxes", []string{"where"}, "box=0,0,1,1",
+			&GeoQuery{Filter: bson.M{"where": bson.M{"$geoWithin": bson.M{"$geometry": box}}}}, nil,
+		},
+		{
+			"parses polygons", []string{"where"}, "within=" + within,
+			&GeoQuery{Filter: bson.M{"where": bson.M{"$geoWithin": bson.M{"$geometry": box}}}}, nil,
+		},
+		{
+			"parses the chosen field", []string{"where", "there"}, "near=1,2&geo_field=there",
+			&GeoQuery{Filter: bson.M{"there": bson.M{"$near": bson.M{"$geometry": point}}}, Near: true}, nil,
+		},
+		{"rejects other fields", []string{"where", "there"}, "near=1,2", nil, map[string][]string{"geo_field": {"geo"}}},
+		{"rejects resources without fields", nil, "near=1,2", nil, map[string][]string{"geo": {"unsupported"}}},
+		{"rejects many criteria", []string{"where"}, "near=1,2&box=0,0,1,1", nil, map[string][]string{"geo": {"unique"}}},
+		{"rejects options alone", []string{"where"}, "max_distance=10", nil, map[string][]string{"max_distance": {"geo"}}},
+		{"rejects invalid points", []string{"where"}, "near=1", nil, map[string][]string{"near": {"point"}}},
+		{
+			"rejects invalid distances", []string{"where"}, "near=1,2&min_distance=-1", nil,
+			map[string][]string{"min_distance": {"distance"}},
+		},
+		{"rejects inverted boxes", []string{"where"}, "box=1,1,0,0", nil, map[string][]string{"box": {"box"}}},
+		{"rejects open polygons", []string{"where"}, "within=" + open, nil, map[string][]string{"within": {"polygon"}}},
+		{
+			"rejects distances on areas", []string{"where"}, "box=0,0,1,1&max_distance=1", nil,
+			map[string][]string{"max_distance": {"near"}},
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			ctx, recorder := newTestContext(http.MethodGet, "/?"+case_.query, nil)
+			query, ok, err := makeGeoParser(case_.geoFields)(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if case_.errors != nil {
+				if ok {
+					t.Fatalf("expected errors %v, got the query %v", case_.errors, query)
+				} else if errors := responseErrors(t, recorder); !reflect.DeepEqual(errors, case_.errors) {
+					t.Fatalf("expected errors %v, got %v", case_.errors, errors)
+				}
+			} else if !ok {
+				t.Fatalf("unexpected errors: %s", recorder.Body.String())
+			} else if !reflect.DeepEqual(query, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, query)
+			}
+		})
+	}
+}
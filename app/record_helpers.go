@@ -1,7 +1,7 @@
 package app
 
 import (
-	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"errors"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -9,36 +9,165 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"maps"
 	"reflect"
+	"slices"
 	"strings"
 )
 
+// errCountNotSupported is returned when counting the documents (or
+// their distinct values or statistics) for criteria that do not
+// support counting (e.g. proximity searches).
+var errCountNotSupported = errors.New("count not supported")
+
+// errNotAttempted is the error of the elements that were not created,
+// in ordered mode, because a prior element failed.
+var errNotAttempted = errors.New("not attempted")
+
 // IDGetter is a function that returns the ID of an object.
 type IDGetter func(any) primitive.ObjectID
 
 // IDSetter is a function that sets the ID to an object.
 type IDSetter func(any, primitive.ObjectID)
 
-// CreateOneFunc stands for a function that creates one element.
-type CreateOneFunc func(echo.Context, any) (primitive.ObjectID, error)
+// CreateOneFunc stands for a function that creates one element. It
+// returns the id and the metadata of the created element.
+type CreateOneFunc func(echo.Context, any) (primitive.ObjectID, ElementMeta, error)
+
+// CreateManyFunc stands for a function that creates many elements,
+// in ordered or unordered mode. It returns the ids of the created
+// elements (nil for the elements not created), the errors of the
+// elements not created, by their index (errNotAttempted for those
+// after the first failed one, in ordered mode), and whether the write
+// concern was not satisfied (the elements were still inserted).
+type CreateManyFunc func(echo.Context, []any, bool) ([]any, map[int]error, bool, error)
 
-// GetOneFunc stands for a function that gets one element.
-type GetOneFunc func(echo.Context, primitive.ObjectID) (any, error)
+// GetOneFunc stands for a function that gets one element, and its
+// metadata. Optionally, the retrieved fields can be narrowed to the
+// given ones.
+type GetOneFunc func(echo.Context, primitive.ObjectID, ...string) (any, ElementMeta, error)
 
-// DeleteOneFunc stands for a function that deletes an element.
-type DeleteOneFunc func(echo.Context, primitive.ObjectID) (bool, error)
+// DeleteOneFunc stands for a function that deletes an element. If
+// expected versions are given, the element must have one of them.
+type DeleteOneFunc func(echo.Context, primitive.ObjectID, []int64) (bool, error)
+
+// DeleteManyFunc stands for a function that deletes many elements,
+// given their ids, as long as they still match the client-provided
+// criteria. It returns the ids of the deleted elements.
+type DeleteManyFunc func(echo.Context, []primitive.ObjectID, ListQuery) ([]primitive.ObjectID, error)
 
 // UpdateOneFunc stands for a function that updates a document.
 type UpdateOneFunc func(echo.Context, primitive.ObjectID, bson.M) (bool, error)
 
-// ReplaceOneFunc stands for a function that replaces a document.
-type ReplaceOneFunc func(echo.Context, primitive.ObjectID, any) (bool, error)
+// ReplaceOneFunc stands for a function that replaces a document. If
+// expected versions are given, the element must have one of them. It
+// returns the metadata of the replaced element.
+type ReplaceOneFunc func(echo.Context, primitive.ObjectID, any, []int64) (bool, ElementMeta, error)
+
+// ListQuery stands for the client-provided criteria to get
+// many documents from a list resource.
+type ListQuery struct {
+	Filter    bson.M
+	Sort      bson.D
+	Page      int64
+	PageSize  int64
+	UseCursor bool
+	Cursor    string
+	Fields    []string
+	Search    string
+	Geo       *GeoQuery
+}
+
+// GetManyFunc stands for a function that gets many documents. When
+// using cursor-based pagination, it also returns the cursor to the
+// next page (which is empty when there are no more elements).
+type GetManyFunc func(echo.Context, ListQuery) ([]any, string, error)
+
+// CountFunc stands for a function that counts the documents matching
+// the client-provided criteria (pagination and sorting do not apply).
+type CountFunc func(echo.Context, ListQuery) (int64, error)
+
+// DistinctFunc stands for a function that gets the distinct values
+// of a field among the documents matching the client-provided criteria.
+type DistinctFunc func(echo.Context, string, ListQuery) ([]any, error)
 
-// GetManyFunc stands for a function that gets many documents.
-type GetManyFunc func(echo.Context, int64, int64) ([]any, error)
+// UpsertOneFunc stands for a function that replaces a document, or
+// creates it when it does not exist. It tells whether the document was
+// created, and its metadata.
+type UpsertOneFunc func(echo.Context, primitive.ObjectID, any) (bool, ElementMeta, error)
 
-// SimulatedUpdateFunc is a function that interacts with a collection
-// and performs a preview of an in-collection update later.
-type SimulatedUpdateFunc func(echo.Context, primitive.ObjectID, any, any) (any, error)
+// GetRawFunc stands for a function that gets one full element as a
+// raw document (with no projection applied).
+type GetRawFunc func(echo.Context, primitive.ObjectID) (bson.Raw, error)
+
+// GuardedReplaceOneFunc stands for a function that replaces a document
+// only if it did not change since it was retrieved (given its original
+// raw content). It tells whether the document was replaced, and
+// its new metadata.
+type GuardedReplaceOneFunc func(echo.Context, bson.Raw, any) (bool, ElementMeta, error)
+
+// Tracking tells which metadata, besides the modification time, is
+// maintained on the writes to the elements of a resource. In resources
+// with history, the prior versions of the changed elements are also
+// recorded (numbered by the writes themselves, which increment the
+// revisions of the elements). It also tells the fields the clients
+// cannot write: the read-only ones and (once set) the immutable ones.
+type Tracking struct {
+	Versioned      bool
+	Audited        bool
+	Revisions      RecordRevisionFunc
+	LatestRevision LatestRevisionFunc
+	ReadOnly       []string
+	Immutable      []string
+}
+
+// pipelined tells whether the replacements must keep any of the
+// stored values (or get the previous document), so they are done
+// by an update pipeline.
+func (tracking Tracking) pipelined() bool {
+	return tracking.Versioned || tracking.Audited || tracking.Revisions != nil ||
+		len(tracking.ReadOnly) != 0 || len(tracking.Immutable) != 0
+}
+
+// record stores the prior version of a changed element, in resources
+// with history.
+func (tracking Tracking) record(ctx echo.Context, previous bson.Raw) {
+	if tracking.Revisions != nil {
+		tracking.Revisions(ctx, previous)
+	}
+}
+
+// increments returns the counters a write increments: the version, in
+// versioned resources, and the revisions, in resources with history.
+func (tracking Tracking) increments() bson.M {
+	increments := bson.M{}
+	if tracking.Versioned {
+		increments[versionField] = 1
+	}
+	if tracking.Revisions != nil {
+		increments[revisionField] = 1
+	}
+	return increments
+}
+
+// document converts an element into the document to store, with the
+// given metadata and extra fields. In audited resources, the update
+// (and, when creating, also the creation) fields are set, discarding
+// any client-provided value for the audit fields. The client-provided
+// values for the read-only fields are also discarded.
+func (tracking Tracking) document(
+	ctx echo.Context, content any, meta ElementMeta, creating bool, fields ...bson.E,
+) (bson.D, error) {
+	document, err := withFields(content)
+	if err != nil {
+		return nil, err
+	}
+	document = withoutFields(document, tracking.ReadOnly...)
+	fields = append(meta.fields(), fields...)
+	if tracking.Audited {
+		document = withoutFields(document, auditFields...)
+		fields = append(fields, auditFieldsOf(ctx, meta.ModifiedAt, creating)...)
+	}
+	return withFields(document, fields...)
+}
 
 // setId sets the id in a filter, if any. It also sets a filter
 // on the _deleted field if softDelete is true.
@@ -46,75 +175,494 @@ func setId(filter bson.M, id primitive.ObjectID, softDelete bool) (bson.M, error
 	// Set the ID.
 	filter_ := bson.M{}
 	maps.Copy(filter_, filter)
-	if id.IsZero() {
-		return filter_, nil
-	} else {
+	if !id.IsZero() {
 		filter_["_id"] = id
-		if softDelete {
-			filter_["_deleted"] = bson.M{"$ne": true}
-		}
-		return filter_, nil
 	}
+	if softDelete {
+		filter_[deletedField] = bson.M{"$ne": true}
+	}
+	return filter_, nil
 }
 
-// makeCreateOne creates a document.
+// makeCreateOne creates a document, telling its modification time.
+// In versioned resources, the document starts at version 1.
 func makeCreateOne(
-	collection *mongo.Collection,
+	collection *mongo.Collection, tracking Tracking,
 ) CreateOneFunc {
-	return func(ctx echo.Context, content any) (primitive.ObjectID, error) {
+	return func(ctx echo.Context, content any) (primitive.ObjectID, ElementMeta, error) {
+		meta := ElementMeta{ModifiedAt: now()}
+		if tracking.Versioned {
+			meta.Version = 1
+		}
+		if document, err := tracking.document(ctx, content, meta, true); err != nil {
+			return primitive.ObjectID{}, meta, err
+		} else {
+			content = document
+		}
 		if result, err := collection.InsertOne(ctx.Request().Context(), content); err != nil {
-			return primitive.ObjectID{}, err
+			return primitive.ObjectID{}, meta, err
+		} else {
+			return result.InsertedID.(primitive.ObjectID), meta, nil
+		}
+	}
+}
+
+// makeCreateMany creates many documents, telling their modification
+// time. In ordered mode, the creation stops at the first failed element.
+// In versioned resources, the documents start at version 1.
+func makeCreateMany(
+	collection *mongo.Collection, tracking Tracking,
+) CreateManyFunc {
+	return func(ctx echo.Context, contents []any, ordered bool) ([]any, map[int]error, bool, error) {
+		meta := ElementMeta{ModifiedAt: now()}
+		if tracking.Versioned {
+			meta.Version = 1
+		}
+		documents := make([]any, len(contents))
+		for index, content := range contents {
+			if document, err := tracking.document(ctx, content, meta, true); err != nil {
+				return nil, nil, false, err
+			} else {
+				documents[index] = document
+			}
+		}
+		result, err := collection.InsertMany(
+			ctx.Request().Context(), documents, options.InsertMany().SetOrdered(ordered),
+		)
+		var bulkErr mongo.BulkWriteException
+		if err != nil && (!errors.As(err, &bulkErr) ||
+			(len(bulkErr.WriteErrors) == 0 && bulkErr.WriteConcernError == nil)) {
+			return nil, nil, false, err
+		}
+
+		failed := map[int]error{}
+		last := len(contents)
+		for _, writeError := range bulkErr.WriteErrors {
+			failed[writeError.Index] = writeError.WriteError
+			if ordered && writeError.Index < last {
+				last = writeError.Index
+			}
+		}
+		ids := make([]any, len(contents))
+		for index := 0; index < len(contents); index++ {
+			if _, ok := failed[index]; ok {
+				continue
+			} else if index > last {
+				failed[index] = errNotAttempted
+			} else {
+				ids[index] = result.InsertedIDs[index]
+			}
+		}
+		return ids, failed, bulkErr.WriteConcernError != nil, nil
+	}
+}
+
+// mergeFilter merges the client-provided filter, if any, into
+// the resource's filter. The resource's filter always applies.
+func mergeFilter(filter bson.M, extra bson.M) bson.M {
+	if len(extra) == 0 {
+		return filter
+	} else if len(filter) == 0 {
+		return extra
+	} else {
+		return bson.M{"$and": bson.A{filter, extra}}
+	}
+}
+
+// sortKeys returns the keys of a sort criteria.
+func sortKeys(sort bson.D) []string {
+	keys := make([]string, len(sort))
+	for index, element := range sort {
+		keys[index] = element.Key
+	}
+	return keys
+}
+
+// withTiebreaker adds the _id field at the end of a sort criteria,
+// unless it is already present, so the order of the elements is
+// stable among different pages.
+func withTiebreaker(sort bson.D) bson.D {
+	for _, element := range sort {
+		if element.Key == "_id" {
+			return sort
+		}
+	}
+	sort_ := make(bson.D, len(sort), len(sort)+1)
+	copy(sort_, sort)
+	return append(sort_, bson.E{Key: "_id", Value: 1})
+}
+
+// isFalsy tells whether a projection value stands for exclusion.
+func isFalsy(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return !v
+	case int:
+		return v == 0
+	case int32:
+		return v == 0
+	case int64:
+		return v == 0
+	case float64:
+		return v == 0
+	default:
+		return false
+	}
+}
+
+// isPathOrAncestor tells whether a (dotted) path is the same as, or an
+// ancestor of, another path.
+func isPathOrAncestor(path, other string) bool {
+	return path == other || strings.HasPrefix(other, path+".")
+}
+
+// exposeFields widens a projection so the given fields are retrieved
+// from the database. It returns the new projection and the paths that
+// were retrieved but not originally exposed (so they can be removed
+// from the retrieved documents before decoding them).
+func exposeFields(projection bson.M, fields []string) (bson.M, []string) {
+	if len(projection) == 0 {
+		return projection, nil
+	}
+
+	// A projection only including the _id field is also an inclusion one.
+	inclusion := false
+	for key, value := range projection {
+		if !isFalsy(value) && (key != "_id" || len(projection) == 1) {
+			inclusion = true
+			break
+		}
+	}
+
+	projection_ := bson.M{}
+	maps.Copy(projection_, projection)
+	var hidden []string
+	for _, field := range fields {
+		if field == "_id" || !inclusion {
+			// The field, or any of its ancestors, might be excluded.
+			for key, value := range projection_ {
+				if isFalsy(value) && isPathOrAncestor(key, field) {
+					delete(projection_, key)
+					hidden = append(hidden, key)
+				}
+			}
 		} else {
-			return result.InsertedID.(primitive.ObjectID), nil
+			// The field, or any of its ancestors, must be included.
+			visible := false
+			for key, value := range projection_ {
+				if !isFalsy(value) && isPathOrAncestor(key, field) {
+					visible = true
+					break
+				}
+			}
+			if !visible {
+				projection_[field] = 1
+				hidden = append(hidden, field)
+			}
+		}
+	}
+	return projection_, hidden
+}
+
+// narrowProjection narrows a projection so only the given (top-level)
+// fields are retrieved, among the ones the projection already exposes:
+// the result never widens the original projection. It returns the new
+// projection and the paths that were retrieved but must be removed from
+// the retrieved documents before decoding them.
+func narrowProjection(projection bson.M, fields []string) (bson.M, []string) {
+	if len(fields) == 0 {
+		return projection, nil
+	}
+
+	inclusion := false
+	for key, value := range projection {
+		if key != "_id" && !isFalsy(value) {
+			inclusion = true
+			break
 		}
 	}
+
+	projection_ := bson.M{}
+	for _, field := range fields {
+		if field == "_id" {
+			continue
+		}
+		if len(projection) == 0 {
+			projection_[field] = 1
+		} else if inclusion {
+			// Keep the field if it is included, or keep its included children.
+			for key, value := range projection {
+				if isFalsy(value) {
+					continue
+				} else if isPathOrAncestor(key, field) {
+					projection_[field] = 1
+					break
+				} else if isPathOrAncestor(field, key) {
+					projection_[key] = value
+				}
+			}
+		} else {
+			// Keep the field unless it is (even partially) excluded.
+			excluded := false
+			for key, value := range projection {
+				if isFalsy(value) && (isPathOrAncestor(key, field) || isPathOrAncestor(field, key)) {
+					excluded = true
+					break
+				}
+			}
+			if !excluded {
+				projection_[field] = 1
+			}
+		}
+	}
+
+	// The _id field keeps its original visibility. If it is hidden and
+	// no other field is retrieved, it is retrieved anyway (otherwise,
+	// the projection would retrieve everything) but then removed.
+	if value, ok := projection["_id"]; ok && isFalsy(value) {
+		if len(projection_) == 0 {
+			projection_["_id"] = 1
+			return projection_, []string{"_id"}
+		}
+		projection_["_id"] = 0
+	} else if len(projection_) == 0 {
+		projection_["_id"] = 1
+	}
+	return projection_, nil
+}
+
+// removePath removes a (dotted) path from a document.
+func removePath(document bson.D, path []string) bson.D {
+	for index, element := range document {
+		if element.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return append(document[:index:index], document[index+1:]...)
+		} else if child, ok := element.Value.(bson.D); ok {
+			document[index].Value = removePath(child, path[1:])
+		}
+		break
+	}
+	return document
+}
+
+// decodeWithout decodes a raw document into an element, but removing
+// the given (dotted) paths first.
+func decodeWithout(raw bson.Raw, paths []string, element any) error {
+	if len(paths) == 0 {
+		return bson.Unmarshal(raw, element)
+	}
+
+	document := bson.D{}
+	if err := bson.Unmarshal(raw, &document); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		document = removePath(document, strings.Split(path, "."))
+	}
+	if raw, err := bson.Marshal(document); err != nil {
+		return err
+	} else {
+		return bson.Unmarshal(raw, element)
+	}
 }
 
-// makeGetMany
+// withSearch adds a full-text search criteria to a filter. The $text
+// operator is kept at the top level of the filter.
+func withSearch(filter bson.M, search string) bson.M {
+	text := bson.M{"$text": bson.M{"$search": search}}
+	if len(filter) == 0 {
+		return text
+	}
+	text["$and"] = bson.A{filter}
+	return text
+}
+
+// withGeo adds a geospatial criteria to a filter. The geospatial
+// criteria is kept at the top level of the filter.
+func withGeo(filter bson.M, geo *GeoQuery) bson.M {
+	geo_ := bson.M{}
+	maps.Copy(geo_, geo.Filter)
+	if len(filter) != 0 {
+		geo_["$and"] = bson.A{filter}
+	}
+	return geo_
+}
+
+// makeGetMany makes a function that returns many elements, according
+// to the client-provided criteria. Returns new elements.
 func makeGetMany(
 	collection *mongo.Collection, make func() any, softDelete bool,
 	filter bson.M, projection bson.M, sort bson.D,
+	encodeCursor CursorEncoderFunc, decodeCursor CursorDecoderFunc,
 ) GetManyFunc {
-	return func(ctx echo.Context, page int64, pageSize int64) ([]any, error) {
+	return func(ctx echo.Context, query ListQuery) ([]any, string, error) {
 		var err error
 		var filter_ bson.M
+		page, pageSize := query.Page, query.PageSize
 
 		// Set the ID.
 		if filter_, err = setId(filter, primitive.NilObjectID, softDelete); err != nil {
-			return nil, err
+			return nil, "", err
+		}
+		filter_ = mergeFilter(filter_, query.Filter)
+
+		// Choose the sort criteria. Full-text searches are sorted
+		// by relevance, unless the client tells otherwise. Proximity
+		// searches are always sorted by distance.
+		sort_ := withTiebreaker(sort)
+		if query.Sort != nil {
+			sort_ = withTiebreaker(query.Sort)
+		} else if query.Search != "" {
+			sort_ = withTiebreaker(bson.D{textScoreSort})
+		}
+		near := query.Geo != nil && query.Geo.Near
+		if query.UseCursor && (near || !isCursorSortable(sort_)) {
+			return nil, "", errCursorNotSupported
 		}
 
 		// Try getting many elements.
 		options_ := options.Find()
-		if len(projection) != 0 {
-			options_.SetProjection(projection)
+		projection_, hidden := narrowProjection(projection, query.Fields)
+		if query.UseCursor {
+			// The sort keys must be retrieved to build the next cursor,
+			// and the elements must come after the ones in the cursor.
+			var hiddenSortKeys []string
+			projection_, hiddenSortKeys = exposeFields(projection_, sortKeys(sort_))
+			hidden = append(hidden, hiddenSortKeys...)
+			if query.Cursor != "" {
+				if values, err := decodeCursor(sort_, query.Cursor); err != nil {
+					return nil, "", err
+				} else {
+					filter_ = mergeFilter(filter_, cursorFilter(sort_, values))
+				}
+			}
 		}
-		if len(sort) != 0 {
-			options_.SetSort(sort)
+		if query.Geo != nil {
+			filter_ = withGeo(filter_, query.Geo)
+		}
+		if query.Search != "" {
+			filter_ = withSearch(filter_, query.Search)
+		}
+		if len(projection_) != 0 {
+			options_.SetProjection(projection_)
+		}
+		if !near {
+			options_.SetSort(sort_)
 		}
 		if pageSize > 0 {
-			options_ = options_.SetLimit(pageSize)
-			if page > 0 {
-				options_ = options_.SetSkip(page * pageSize)
+			if query.UseCursor {
+				// One more element is retrieved to know whether there
+				// is a next page or not.
+				options_ = options_.SetLimit(pageSize + 1)
+			} else {
+				options_ = options_.SetLimit(pageSize)
+				if page > 0 {
+					options_ = options_.SetSkip(page * pageSize)
+				}
 			}
 		}
 		if cursor, err := collection.Find(
 			ctx.Request().Context(), filter_, options_,
 		); err != nil {
-			return nil, err
+			return nil, "", err
 		} else {
-			defer func(cursor *mongo.Cursor, ctx echo.Context) {
-				_ = cursor.Close(ctx.Request().Context())
-			}(cursor, ctx)
-			var elements = []any{}
-			for cursor.Next(ctx.Request().Context()) {
-				element := make()
-				if err := cursor.Decode(element); err != nil {
-					return nil, err
-				}
-				elements = append(elements, element)
+			return decodeMany(ctx, cursor, make, hidden, query, sort_, encodeCursor)
+		}
+	}
+}
+
+// decodeMany decodes the documents from a Find / Aggregate result.
+// When using cursor-based pagination, one more document than the
+// page size is expected to exist if there is a next page, and the
+// cursor to that page is built from the last decoded element.
+func decodeMany(
+	ctx echo.Context, cursor *mongo.Cursor, make func() any, hidden []string,
+	query ListQuery, sort bson.D, encodeCursor CursorEncoderFunc,
+) ([]any, string, error) {
+	defer func(cursor *mongo.Cursor, ctx echo.Context) {
+		_ = cursor.Close(ctx.Request().Context())
+	}(cursor, ctx)
+	var elements = []any{}
+	var last bson.Raw
+	for cursor.Next(ctx.Request().Context()) {
+		if query.UseCursor && query.PageSize > 0 && int64(len(elements)) == query.PageSize {
+			// This is the extra element: there is a next page.
+			next, err := encodeCursor(sort, cursorValues(sort, last))
+			return elements, next, err
+		}
+		element := make()
+		if err := decodeWithout(cursor.Current, hidden, element); err != nil {
+			return nil, "", err
+		}
+		elements = append(elements, element)
+		last = append(last[:0], cursor.Current...)
+	}
+	return elements, "", cursor.Err()
+}
+
+// makeCount makes a function that counts the elements matching the
+// client-provided criteria (besides the resource's filter). Proximity
+// criteria are not supported while counting.
+func makeCount(
+	collection *mongo.Collection, softDelete bool, filter bson.M,
+) CountFunc {
+	return func(ctx echo.Context, query ListQuery) (int64, error) {
+		var err error
+		var filter_ bson.M
+
+		// Set the ID.
+		if filter_, err = setId(filter, primitive.NilObjectID, softDelete); err != nil {
+			return 0, err
+		}
+		filter_ = mergeFilter(filter_, query.Filter)
+		if query.Geo != nil {
+			if query.Geo.Near {
+				return 0, errCountNotSupported
 			}
-			return elements, nil
+			filter_ = withGeo(filter_, query.Geo)
+		}
+		if query.Search != "" {
+			filter_ = withSearch(filter_, query.Search)
+		}
+
+		return collection.CountDocuments(ctx.Request().Context(), filter_)
+	}
+}
+
+// makeDistinct makes a function that gets the distinct values of a
+// field among the elements matching the client-provided criteria
+// (besides the resource's filter). Proximity criteria are not
+// supported here.
+func makeDistinct(
+	collection *mongo.Collection, softDelete bool, filter bson.M,
+) DistinctFunc {
+	return func(ctx echo.Context, field string, query ListQuery) ([]any, error) {
+		var err error
+		var filter_ bson.M
+
+		// Set the ID.
+		if filter_, err = setId(filter, primitive.NilObjectID, softDelete); err != nil {
+			return nil, err
+		}
+		filter_ = mergeFilter(filter_, query.Filter)
+		if query.Geo != nil {
+			if query.Geo.Near {
+				return nil, errCountNotSupported
+			}
+			filter_ = withGeo(filter_, query.Geo)
+		}
+		if query.Search != "" {
+			filter_ = withSearch(filter_, query.Search)
+		}
+
+		if values, err := collection.Distinct(ctx.Request().Context(), field, filter_); err != nil {
+			return nil, err
+		} else if values == nil {
+			return []any{}, nil
+		} else {
+			return values, nil
 		}
 	}
 }
@@ -124,19 +672,22 @@ func makeGetOne(
 	collection *mongo.Collection, make func() any, softDelete bool,
 	filter bson.M, projection bson.M, sort bson.D,
 ) GetOneFunc {
-	return func(ctx echo.Context, id primitive.ObjectID) (any, error) {
+	return func(ctx echo.Context, id primitive.ObjectID, fields ...string) (any, ElementMeta, error) {
 		var err error
 		var filter_ bson.M
 
 		// Set the ID.
 		if filter_, err = setId(filter, id, softDelete); err != nil {
-			return nil, err
+			return nil, ElementMeta{}, err
 		}
 
-		// Try getting an element.
+		// Try getting an element (and its metadata).
 		options_ := options.FindOne()
-		if len(projection) != 0 {
-			options_.SetProjection(projection)
+		projection_, hidden := narrowProjection(projection, fields)
+		projection_, hiddenMeta := exposeFields(projection_, metaFields)
+		hidden = append(hidden, hiddenMeta...)
+		if len(projection_) != 0 {
+			options_.SetProjection(projection_)
 		}
 		if len(sort) != 0 {
 			options_.SetSort(sort)
@@ -146,34 +697,61 @@ func makeGetOne(
 
 		err = result.Err()
 		if err != nil {
-			return nil, err
+			return nil, ElementMeta{}, err
 		}
 
 		// Decode the result.
 		obj := make()
-		if err := result.Decode(obj); err != nil {
-			return nil, err
+		if raw, err := result.DecodeBytes(); err != nil {
+			return nil, ElementMeta{}, err
+		} else if err := decodeWithout(raw, hidden, obj); err != nil {
+			return nil, ElementMeta{}, err
 		} else {
-			return obj, nil
+			return obj, readMeta(raw), nil
 		}
 	}
 }
 
 // makeDeleteOne makes a function that deletes a single element.
 func makeDeleteOne(
-	collection *mongo.Collection, filter bson.M, softDelete bool,
+	collection *mongo.Collection, filter bson.M, softDelete bool, tracking Tracking,
 ) DeleteOneFunc {
-	return func(ctx echo.Context, id primitive.ObjectID) (bool, error) {
+	return func(ctx echo.Context, id primitive.ObjectID, versions []int64) (bool, error) {
 		var err error
 		var filter_ bson.M
 
-		// Set the ID.
+		// Set the ID and the expected versions.
 		if filter_, err = setId(filter, id, softDelete); err != nil {
 			return false, err
 		}
+		filter_ = withVersions(filter_, versions)
 
-		// Try deleting an element.
-		if result, err := collection.DeleteOne(
+		// Try deleting an element (just marking it, on soft delete),
+		// also recording its prior version when there is history.
+		if tracking.Revisions != nil {
+			var result *mongo.SingleResult
+			if softDelete {
+				result = collection.FindOneAndUpdate(ctx.Request().Context(), filter_, softDeleteUpdate(tracking))
+			} else {
+				result = collection.FindOneAndDelete(ctx.Request().Context(), filter_)
+			}
+			if previous, err := result.DecodeBytes(); errors.Is(err, mongo.ErrNoDocuments) {
+				return false, nil
+			} else if err != nil {
+				return false, err
+			} else {
+				tracking.record(ctx, previous)
+				return true, nil
+			}
+		} else if softDelete {
+			if result, err := collection.UpdateOne(
+				ctx.Request().Context(), filter_, softDeleteUpdate(tracking),
+			); err != nil {
+				return false, err
+			} else {
+				return result.MatchedCount > 0, nil
+			}
+		} else if result, err := collection.DeleteOne(
 			ctx.Request().Context(), filter_,
 		); err != nil {
 			return false, err
@@ -183,6 +761,56 @@ func makeDeleteOne(
 	}
 }
 
+// makeDeleteMany makes a function that deletes many documents, given
+// their ids, as long as they still match the client-provided criteria
+// (besides the resource's filter). Each document is deleted on its own,
+// so the deleted ones are known (and their prior versions are recorded
+// when there is history). Proximity criteria are not supported here.
+func makeDeleteMany(
+	collection *mongo.Collection, filter bson.M, softDelete bool, tracking Tracking,
+) DeleteManyFunc {
+	return func(ctx echo.Context, ids []primitive.ObjectID, query ListQuery) ([]primitive.ObjectID, error) {
+		deleted := []primitive.ObjectID{}
+		for _, id := range ids {
+			var err error
+			var filter_ bson.M
+
+			// Set the ID and the client-provided criteria.
+			if filter_, err = setId(filter, id, softDelete); err != nil {
+				return deleted, err
+			}
+			filter_ = mergeFilter(filter_, query.Filter)
+			if query.Geo != nil {
+				if query.Geo.Near {
+					return deleted, errCountNotSupported
+				}
+				filter_ = withGeo(filter_, query.Geo)
+			}
+			if query.Search != "" {
+				filter_ = withSearch(filter_, query.Search)
+			}
+
+			// Try deleting the element (just marking it, on soft delete),
+			// also recording its prior version when there is history.
+			var result *mongo.SingleResult
+			if softDelete {
+				result = collection.FindOneAndUpdate(ctx.Request().Context(), filter_, softDeleteUpdate(tracking))
+			} else {
+				result = collection.FindOneAndDelete(ctx.Request().Context(), filter_)
+			}
+			if previous, err := result.DecodeBytes(); errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			} else if err != nil {
+				return deleted, err
+			} else {
+				deleted = append(deleted, id)
+				tracking.record(ctx, previous)
+			}
+		}
+		return deleted, nil
+	}
+}
+
 // makeUpdateOne makes a function that patches a document.
 func makeUpdateOne(
 	collection *mongo.Collection, filter bson.M, softDelete bool,
@@ -207,62 +835,317 @@ func makeUpdateOne(
 	}
 }
 
+// replaceDocument replaces a document, or creates it (if told to, and
+// it does not exist), setting its new modification time. In versioned
+// resources, the replacement and the increment of the version happen
+// atomically, and so does keeping the creation fields in audited ones
+// and the stored read-only and immutable fields. In resources with
+// history, the prior version is recorded. It tells whether the document
+// existed or was created.
+func replaceDocument(
+	ctx echo.Context, collection *mongo.Collection, filter bson.M, replacement any, tracking Tracking, upsert bool,
+	fields ...bson.E,
+) (bool, bool, ElementMeta, error) {
+	meta := ElementMeta{ModifiedAt: now()}
+	document, err := tracking.document(ctx, replacement, meta, false, fields...)
+	if err != nil {
+		return false, false, meta, err
+	}
+
+	if !tracking.pipelined() {
+		// Try replacing an element.
+		if result, err := collection.ReplaceOne(
+			ctx.Request().Context(), filter, document, options.Replace().SetUpsert(upsert),
+		); err != nil {
+			return false, false, meta, err
+		} else {
+			return result.ModifiedCount > 0, result.UpsertedCount > 0, meta, nil
+		}
+	}
+
+	// Try replacing an element, keeping its id (and its creation and
+	// protected fields) and incrementing its version. The immutable
+	// fields take the client-provided values only while absent.
+	kept := bson.M{"_id": "$_id"}
+	for _, field := range tracking.ReadOnly {
+		kept[field] = "$" + field
+	}
+	for _, field := range tracking.Immutable {
+		if index := slices.IndexFunc(document, func(element bson.E) bool { return element.Key == field }); index >= 0 {
+			kept[field] = bson.M{"$ifNull": bson.A{"$" + field, bson.M{"$literal": document[index].Value}}}
+		} else {
+			kept[field] = "$" + field
+		}
+	}
+	document = withoutFields(document, tracking.Immutable...)
+	if tracking.Versioned {
+		kept[versionField] = bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$" + versionField, 0}}, 1}}
+	}
+	if tracking.Revisions != nil {
+		kept[revisionField] = bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$" + revisionField, 0}}, 1}}
+	}
+	if tracking.Audited {
+		kept[createdAtField] = bson.M{"$ifNull": bson.A{"$" + createdAtField, meta.ModifiedAt}}
+		kept[createdByField] = bson.M{"$ifNull": bson.A{"$" + createdByField, actorOf(ctx)}}
+	}
+	update := bson.A{bson.M{"$replaceWith": bson.M{"$mergeObjects": bson.A{
+		bson.M{"$literal": document}, kept,
+	}}}}
+	options_ := options.FindOneAndUpdate().SetReturnDocument(options.Before).SetUpsert(upsert)
+	if tracking.Revisions == nil {
+		options_.SetProjection(bson.M{versionField: 1})
+	}
+	if raw, err := collection.FindOneAndUpdate(
+		ctx.Request().Context(), filter, update, options_,
+	).DecodeBytes(); errors.Is(err, mongo.ErrNoDocuments) {
+		if upsert && tracking.Versioned {
+			meta.Version = 1
+		}
+		return false, upsert, meta, nil
+	} else if err != nil {
+		return false, false, meta, err
+	} else {
+		if tracking.Versioned {
+			meta.Version = readMeta(raw).Version + 1
+		}
+		tracking.record(ctx, raw)
+		return true, false, meta, nil
+	}
+}
+
 // makeReplaceOne makes a function that replaces a document.
 func makeReplaceOne(
-	collection *mongo.Collection, filter bson.M, softDelete bool,
+	collection *mongo.Collection, filter bson.M, softDelete bool, tracking Tracking,
 ) ReplaceOneFunc {
-	return func(ctx echo.Context, id primitive.ObjectID, replacement any) (bool, error) {
+	return func(ctx echo.Context, id primitive.ObjectID, replacement any, versions []int64) (bool, ElementMeta, error) {
 		var err error
 		var filter_ bson.M
 
-		// Set the ID.
+		// Set the ID and the expected versions.
 		if filter_, err = setId(filter, id, softDelete); err != nil {
-			return false, err
+			return false, ElementMeta{}, err
 		}
+		filter_ = withVersions(filter_, versions)
 
 		// Try replacing an element.
+		replaced, _, meta, err := replaceDocument(ctx, collection, filter_, replacement, tracking, false)
+		return replaced, meta, err
+	}
+}
+
+// filterEqualities returns the top-level equality conditions of a
+// filter (either plain values or $eq operators), sorted by field.
+func filterEqualities(filter bson.M) []bson.E {
+	var fields []bson.E
+	for key, value := range filter {
+		if strings.HasPrefix(key, "$") || strings.Contains(key, ".") {
+			continue
+		}
+		// Documents with operators are conditions, and only $eq
+		// stands for an equality. Other values are equalities.
+		var condition bson.D
+		switch v := value.(type) {
+		case bson.M:
+			for key, value := range v {
+				condition = append(condition, bson.E{Key: key, Value: value})
+			}
+		case bson.D:
+			condition = v
+		}
+		if len(condition) == 0 || !strings.HasPrefix(condition[0].Key, "$") {
+			fields = append(fields, bson.E{Key: key, Value: value})
+		} else if len(condition) == 1 && condition[0].Key == "$eq" {
+			fields = append(fields, bson.E{Key: key, Value: condition[0].Value})
+		}
+	}
+	slices.SortFunc(fields, func(a, b bson.E) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return fields
+}
+
+// makeUpsertOne makes a function that replaces a document, or creates
+// it with the given id when it does not exist. The created documents
+// get the equality conditions of the resource's filter, so they match
+// it. An id belonging to a document not matching the filter (or being
+// deleted) fails as a duplicate key.
+func makeUpsertOne(
+	collection *mongo.Collection, filter bson.M, softDelete bool, tracking Tracking,
+) UpsertOneFunc {
+	equalities := filterEqualities(filter)
+	return func(ctx echo.Context, id primitive.ObjectID, replacement any) (bool, ElementMeta, error) {
+		var err error
+		var filter_ bson.M
+
+		// Set the ID.
+		if filter_, err = setId(filter, id, softDelete); err != nil {
+			return false, ElementMeta{}, err
+		}
+
+		// Try replacing or creating an element.
+		fields := append([]bson.E{{Key: "_id", Value: id}}, equalities...)
+		if tracking.LatestRevision == nil {
+			_, created, meta, err := replaceDocument(ctx, collection, filter_, replacement, tracking, true, fields...)
+			return created, meta, err
+		}
+
+		// In resources with history, the id may belong to a former
+		// element (e.g. a deleted one) whose revisions are kept. So the
+		// element is replaced if it exists or, otherwise, created on its
+		// own, with its revisions following the former ones. If another
+		// request creates it meanwhile, it is replaced once again, so
+		// both requests succeed.
+		fields = append(fields, bson.E{Key: revisionField})
+		for retried := false; ; retried = true {
+			if replaced, _, meta, err := replaceDocument(
+				ctx, collection, filter_, replacement, tracking, false,
+			); err != nil || replaced {
+				return false, meta, err
+			}
+			latest, err := tracking.LatestRevision(ctx, id)
+			if err != nil {
+				return false, ElementMeta{}, err
+			}
+			meta := ElementMeta{ModifiedAt: now()}
+			if tracking.Versioned {
+				meta.Version = 1
+			}
+			fields[len(fields)-1].Value = latest
+			if document, err := tracking.document(ctx, replacement, meta, true, fields...); err != nil {
+				return false, meta, err
+			} else if _, err := collection.InsertOne(
+				ctx.Request().Context(), document,
+			); mongo.IsDuplicateKeyError(err) && !retried {
+				continue
+			} else if err != nil {
+				return false, meta, err
+			}
+			return true, meta, nil
+		}
+	}
+}
+
+// makeGetRaw makes a function that gets one full element as a raw
+// document, so it can be patched.
+func makeGetRaw(
+	collection *mongo.Collection, softDelete bool, filter bson.M, sort bson.D,
+) GetRawFunc {
+	return func(ctx echo.Context, id primitive.ObjectID) (bson.Raw, error) {
+		var err error
+		var filter_ bson.M
+
+		// Set the ID.
+		if filter_, err = setId(filter, id, softDelete); err != nil {
+			return nil, err
+		}
+
+		// Try getting an element.
+		options_ := options.FindOne()
+		if len(sort) != 0 {
+			options_.SetSort(sort)
+		}
+		return collection.FindOne(ctx.Request().Context(), filter_, options_).DecodeBytes()
+	}
+}
+
+// makeGuardedReplaceOne makes a function that atomically replaces a
+// document, but only when it still matches the resource's filter and
+// its content is still the original one (i.e. no concurrent write
+// happened since it was retrieved). It also sets the modification
+// time and, in versioned resources, the new version is the original
+// one plus 1. The original read-only and immutable fields (and, in
+// audited resources, the creation fields) are kept and, in resources
+// with history, the original is recorded.
+func makeGuardedReplaceOne(
+	collection *mongo.Collection, filter bson.M, softDelete bool, tracking Tracking,
+) GuardedReplaceOneFunc {
+	return func(ctx echo.Context, original bson.Raw, replacement any) (bool, ElementMeta, error) {
+		var err error
+		var filter_ bson.M
+
+		// Set the ID and the guard.
+		if filter_, err = setId(filter, primitive.NilObjectID, softDelete); err != nil {
+			return false, ElementMeta{}, err
+		}
+		filter_ = mergeFilter(filter_, bson.M{
+			"_id":   original.Lookup("_id"),
+			"$expr": bson.M{"$eq": bson.A{"$$ROOT", bson.M{"$literal": original}}},
+		})
+
+		// Set the new metadata.
+		meta := ElementMeta{ModifiedAt: now()}
+		if tracking.Versioned {
+			meta.Version = readMeta(original).Version + 1
+		}
+		kept := fieldsOf(original, slices.Concat(tracking.ReadOnly, tracking.Immutable)...)
+		if tracking.Audited {
+			kept = append(kept, fieldsOf(original, createdAtField, createdByField)...)
+		}
+		if tracking.Revisions != nil {
+			kept = append(kept, bson.E{Key: revisionField, Value: revisionOf(original)})
+		}
+		if replacement, err = tracking.document(ctx, replacement, meta, false, kept...); err != nil {
+			return false, meta, err
+		}
+
+		// Try replacing the element.
 		if result, err := collection.ReplaceOne(
 			ctx.Request().Context(), filter_, replacement,
 		); err != nil {
-			return false, err
+			return false, meta, err
+		} else if result.MatchedCount == 0 {
+			return false, meta, nil
 		} else {
-			return result.ModifiedCount > 0, nil
+			tracking.record(ctx, original)
+			return true, meta, nil
 		}
 	}
 }
 
-// makeSimulatedUpdate makes a function that performs a simulated update
-// (using on a temporary collection) to simulate an actual update on the
-// object, and retrieve it (as a full preview) so it can be validated
-// before making the actual in-collection update.
-func makeSimulatedUpdate(
-	tmpCollection *mongo.Collection, make dsl.ModelTypeFunction,
-) SimulatedUpdateFunc {
-	return func(ctx echo.Context, entityId primitive.ObjectID, entity, updates any) (any, error) {
-		filter := bson.M{"_id": entityId}
-		if _, err := tmpCollection.ReplaceOne(
-			ctx.Request().Context(), filter, entity, options.Replace().SetUpsert(true),
-		); err != nil {
-			return nil, err
-		} else if _, err := tmpCollection.UpdateOne(ctx.Request().Context(), filter, updates); err != nil {
-			return nil, err
-		} else if result := tmpCollection.FindOne(ctx.Request().Context(), filter); result.Err() != nil {
-			return nil, err
-		} else {
-			obj := make()
-			var map_ = bson.M{}
-			if err := result.Decode(map_); err != nil {
-				return nil, err
+// makeModelFields returns the types of the fields of a model struct,
+// keyed by the names they are mapped to in BSON. Inlined structs are
+// traversed, while the fields explicitly ignored in BSON are skipped.
+func makeModelFields(template any) map[string]reflect.Type {
+	if template == nil {
+		panic("the template is null")
+	}
+
+	fields := map[string]reflect.Type{}
+	var collect func(typ reflect.Type)
+	collect = func(typ reflect.Type) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			tagParts := strings.Split(field.Tag.Get("bson"), ",")
+			name := tagParts[0]
+			if name == "-" {
+				continue
+			}
+			inline := false
+			for _, part := range tagParts[1:] {
+				if part == "inline" {
+					inline = true
+				}
+			}
+			if inline && field.Type.Kind() == reflect.Struct {
+				collect(field.Type)
+				continue
 			}
-			delete(map_, "_id")
-			if raw, err := bson.Marshal(map_); err != nil {
-				return nil, err
-			} else if err := bson.Unmarshal(raw, obj); err != nil {
-				return nil, err
+			if name == "" {
+				name = strings.ToLower(field.Name)
 			}
-			return obj, nil
+			fields[name] = field.Type
 		}
 	}
+
+	typ := reflect.TypeOf(template)
+	if typ.Kind() != reflect.Struct {
+		panic("the type is not a struct: " + typ.Name())
+	}
+	collect(typ)
+	return fields
 }
 
 // makeIDAccessors returns a function which is the ID getter for a struct.
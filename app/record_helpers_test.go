@@ -0,0 +1,151 @@
+package app
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"testing"
+)
+
+func TestExposeFields(t *testing.T) {
+	cases := []struct {
+		name       string
+		projection bson.M
+		fields     []string
+		expected   bson.M
+		hidden     []string
+	}{
+		{"keeps empty projections", bson.M{}, []string{"a"}, bson.M{}, nil},
+		{"keeps included fields", bson.M{"a": 1}, []string{"a"}, bson.M{"a": 1}, nil},
+		{"keeps fields with included ancestors", bson.M{"a": true}, []string{"a.b"}, bson.M{"a": true}, nil},
+		{"includes missing fields", bson.M{"a": 1}, []string{"b.c"}, bson.M{"a": 1, "b.c": 1}, []string{"b.c"}},
+		{"keeps fields not excluded", bson.M{"a": 0}, []string{"b"}, bson.M{"a": 0}, nil},
+		{"removes excluded fields", bson.M{"a": 0, "b": 0}, []string{"a"}, bson.M{"b": 0}, []string{"a"}},
+		{"removes excluded ancestors", bson.M{"a": false}, []string{"a.b"}, bson.M{}, []string{"a"}},
+		{"removes the excluded _id", bson.M{"_id": 0, "a": 1}, []string{"_id"}, bson.M{"a": 1}, []string{"_id"}},
+		{"tells _id-only projections as inclusion", bson.M{"_id": 1}, []string{"a"}, bson.M{"_id": 1, "a": 1}, []string{"a"}},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			projection, hidden := exposeFields(case_.projection, case_.fields)
+			if !reflect.DeepEqual(projection, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, projection)
+			} else if !reflect.DeepEqual(hidden, case_.hidden) {
+				t.Fatalf("expected the hidden paths %v, got %v", case_.hidden, hidden)
+			}
+		})
+	}
+}
+
+func TestDecodeWithout(t *testing.T) {
+	raw, _ := bson.Marshal(bson.D{
+		{Key: "_id", Value: "x"}, {Key: "a", Value: bson.D{{Key: "b", Value: 1}, {Key: "c", Value: 2}}},
+	})
+	cases := []struct {
+		name     string
+		paths    []string
+		expected bson.M
+	}{
+		{"decodes everything", nil, bson.M{"_id": "x", "a": bson.M{"b": int32(1), "c": int32(2)}}},
+		{"removes top-level paths", []string{"_id"}, bson.M{"a": bson.M{"b": int32(1), "c": int32(2)}}},
+		{"removes nested paths", []string{"a.b"}, bson.M{"_id": "x", "a": bson.M{"c": int32(2)}}},
+		{"ignores missing paths", []string{"d.e", "_id.f"}, bson.M{"_id": "x", "a": bson.M{"b": int32(1), "c": int32(2)}}},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			element := bson.M{}
+			if err := decodeWithout(raw, case_.paths, &element); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if !reflect.DeepEqual(element, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, element)
+			}
+		})
+	}
+}
+
+func TestNarrowProjection(t *testing.T) {
+	cases := []struct {
+		name       string
+		projection bson.M
+		fields     []string
+		expected   bson.M
+		hidden     []string
+	}{
+		{"keeps the projection without fields", bson.M{"a": 1}, nil, bson.M{"a": 1}, nil},
+		{"includes fields without a projection", nil, []string{"a", "b"}, bson.M{"a": 1, "b": 1}, nil},
+		{"keeps included fields", bson.M{"a": 1, "b": 1}, []string{"a"}, bson.M{"a": 1}, nil},
+		{"keeps the included children", bson.M{"a.b": 1, "a.c": 1, "d": 1}, []string{"a"}, bson.M{"a.b": 1, "a.c": 1}, nil},
+		{"keeps fields with included ancestors", bson.M{"a": 1}, []string{"a.b"}, bson.M{"a.b": 1}, nil},
+		{"never widens inclusions", bson.M{"a": 1}, []string{"b"}, bson.M{"_id": 1}, nil},
+		{"keeps fields not excluded", bson.M{"a": 0}, []string{"a", "b"}, bson.M{"b": 1}, nil},
+		{"drops partially excluded fields", bson.M{"a.b": 0}, []string{"a", "c"}, bson.M{"c": 1}, nil},
+		{"retrieves _id alone", nil, []string{"_id"}, bson.M{"_id": 1}, nil},
+		{"keeps _id hidden", bson.M{"_id": 0, "a": 1}, []string{"_id", "a"}, bson.M{"_id": 0, "a": 1}, nil},
+		{"removes the hidden _id", bson.M{"_id": 0, "a": 1}, []string{"b"}, bson.M{"_id": 1}, []string{"_id"}},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			projection, hidden := narrowProjection(case_.projection, case_.fields)
+			if !reflect.DeepEqual(projection, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, projection)
+			} else if !reflect.DeepEqual(hidden, case_.hidden) {
+				t.Fatalf("expected the hidden paths %v, got %v", case_.hidden, hidden)
+			}
+		})
+	}
+}
+
+func TestWithSearch(t *testing.T) {
+	text := bson.M{"$search": "x y"}
+	if filter := withSearch(nil, "x y"); !reflect.DeepEqual(filter, bson.M{"$text": text}) {
+		t.Fatalf("expected only the text criteria, got %v", filter)
+	}
+	expected := bson.M{"$text": text, "$and": bson.A{bson.M{"a": 1}}}
+	if filter := withSearch(bson.M{"a": 1}, "x y"); !reflect.DeepEqual(filter, expected) {
+		t.Fatalf("expected %v, got %v", expected, filter)
+	}
+}
+
+func TestWithGeo(t *testing.T) {
+	geo := &GeoQuery{Filter: bson.M{"where": bson.M{"$near": bson.M{}}}}
+	if filter := withGeo(nil, geo); !reflect.DeepEqual(filter, geo.Filter) {
+		t.Fatalf("expected only the geospatial criteria, got %v", filter)
+	}
+	expected := bson.M{"where": bson.M{"$near": bson.M{}}, "$and": bson.A{bson.M{"a": 1}}}
+	if filter := withGeo(bson.M{"a": 1}, geo); !reflect.DeepEqual(filter, expected) {
+		t.Fatalf("expected %v, got %v", expected, filter)
+	} else if _, ok := geo.Filter["$and"]; ok {
+		t.Fatalf("the original criteria was changed: %v", geo.Filter)
+	}
+}
+
+func TestFilterEqualities(t *testing.T) {
+	cases := []struct {
+		name     string
+		filter   bson.M
+		expected []bson.E
+	}{
+		{"tells nothing for no filter", nil, nil},
+		{
+			"tells plain values sorted", bson.M{"b": "x", "a": 1, "c": bson.M{"d": 2}},
+			[]bson.E{{Key: "a", Value: 1}, {Key: "b", Value: "x"}, {Key: "c", Value: bson.M{"d": 2}}},
+		},
+		{
+			"tells $eq operators", bson.M{"a": bson.M{"$eq": 1}, "b": bson.D{{Key: "$eq", Value: 2}}},
+			[]bson.E{{Key: "a", Value: 1}, {Key: "b", Value: 2}},
+		},
+		{"skips other operators", bson.M{"a": bson.M{"$gt": 1}, "b": bson.M{"$eq": 1, "$ne": 2}}, nil},
+		{"skips top-level operators", bson.M{"$or": bson.A{bson.M{"a": 1}}}, nil},
+		{"skips dotted fields", bson.M{"a.b": 1}, nil},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if fields := filterEqualities(case_.filter); !reflect.DeepEqual(fields, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, fields)
+			}
+		})
+	}
+}
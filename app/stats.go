@@ -0,0 +1,182 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/responses"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// statsCount is the name of the always-allowed counting metric.
+const statsCount = "count"
+
+// errTooManyGroups is returned when the statistics yield more groups
+// than the resource allows, so the result would be incomplete.
+var errTooManyGroups = errors.New("too many groups")
+
+// StatsMetric stands for an accumulator applied to a field.
+type StatsMetric struct {
+	Accumulator dsl.StatsAccumulator
+	Field       string
+}
+
+// StatsQuery stands for the client-provided statistics criteria:
+// the fields to group by, and the metrics to compute for each group
+// (besides the count, which is always computed).
+type StatsQuery struct {
+	GroupBy []string
+	Metrics []StatsMetric
+}
+
+// StatsParserFunc stands for a function that parses the statistics
+// criteria in the query string, given the client's request.
+type StatsParserFunc func(echo.Context) (StatsQuery, bool, error)
+
+// StatsFunc stands for a function that computes the statistics of
+// the elements matching the client-provided criteria.
+type StatsFunc func(echo.Context, ListQuery, StatsQuery) ([]bson.M, error)
+
+// makeStatsParser makes a function that parses the statistics given
+// by the clients in the "group_by" and "metrics" query string
+// parameters, in the format: group_by=field1,field2 and
+// metrics=sum:field1,avg:field2. Only the fields and accumulators
+// allowed by the resource's stats settings are allowed.
+func makeStatsParser(stats *dsl.Stats, modelFields map[string]reflect.Type) StatsParserFunc {
+	for _, field := range stats.GroupBy {
+		if _, ok := modelFields[field]; !ok && field != "_id" {
+			panic("the stats group field is not mapped in the model: " + field)
+		}
+	}
+	for field := range stats.Accumulators {
+		if _, ok := modelFields[field]; !ok {
+			panic("the stats accumulated field is not mapped in the model: " + field)
+		}
+	}
+
+	return func(ctx echo.Context) (StatsQuery, bool, error) {
+		query := StatsQuery{}
+		errors := map[string][]string{}
+
+		if param := strings.TrimSpace(ctx.QueryParam("group_by")); param != "" {
+			for _, token := range strings.Split(param, ",") {
+				token = strings.TrimSpace(token)
+				if token == "" {
+					addQueryError(errors, "group_by", "syntax")
+				} else if !slices.Contains(stats.GroupBy, token) {
+					addQueryError(errors, "group_by."+token, "groupable")
+				} else if slices.Contains(query.GroupBy, token) {
+					addQueryError(errors, "group_by."+token, "unique")
+				} else {
+					query.GroupBy = append(query.GroupBy, token)
+				}
+			}
+		}
+
+		if param := strings.TrimSpace(ctx.QueryParam("metrics")); param != "" {
+			for _, token := range strings.Split(param, ",") {
+				token = strings.TrimSpace(token)
+				if token == statsCount {
+					// Counting is always computed.
+					continue
+				}
+				accumulator, field, found := strings.Cut(token, ":")
+				metric := StatsMetric{Accumulator: dsl.StatsAccumulator(accumulator), Field: field}
+				if !found || accumulator == "" || field == "" {
+					addQueryError(errors, "metrics", "syntax")
+				} else if !slices.Contains(stats.Accumulators[field], metric.Accumulator) {
+					addQueryError(errors, "metrics."+token, "accumulator")
+				} else if slices.Contains(query.Metrics, metric) {
+					addQueryError(errors, "metrics."+token, "unique")
+				} else {
+					query.Metrics = append(query.Metrics, metric)
+				}
+			}
+		}
+
+		if len(errors) != 0 {
+			return query, false, responses.InvalidQuery(ctx, errors)
+		}
+		return query, true, nil
+	}
+}
+
+// makeStats makes a function that computes the statistics of the
+// elements matching the client-provided criteria (besides the resource's
+// filter). Each resulting group is rendered like this:
+//
+//	{"group": {"field1": ...}, "count": ..., "sum": {"field2": ...}}
+//
+// Proximity criteria are not supported here, and it is an error to
+// yield more than maxGroups groups (when it is positive).
+func makeStats(
+	collection *mongo.Collection, softDelete bool, filter bson.M, maxGroups int64,
+) StatsFunc {
+	return func(ctx echo.Context, query ListQuery, stats StatsQuery) ([]bson.M, error) {
+		var err error
+		var filter_ bson.M
+
+		// Set the ID.
+		if filter_, err = setId(filter, primitive.NilObjectID, softDelete); err != nil {
+			return nil, err
+		}
+		filter_ = mergeFilter(filter_, query.Filter)
+		if query.Geo != nil {
+			if query.Geo.Near {
+				return nil, errCountNotSupported
+			}
+			filter_ = withGeo(filter_, query.Geo)
+		}
+		if query.Search != "" {
+			filter_ = withSearch(filter_, query.Search)
+		}
+
+		// Prepare the group and the final projection. The groups and
+		// the accumulated values have generated names, since the field
+		// names might not be valid as names here.
+		groupId := bson.D{}
+		projection := bson.D{{Key: "_id", Value: 0}}
+		for index, field := range stats.GroupBy {
+			name := fmt.Sprintf("g%d", index)
+			groupId = append(groupId, bson.E{Key: name, Value: "$" + field})
+			projection = append(projection, bson.E{Key: "group." + field, Value: "$_id." + name})
+		}
+		group := bson.D{{Key: "_id", Value: groupId}, {Key: statsCount, Value: bson.M{"$sum": 1}}}
+		projection = append(projection, bson.E{Key: statsCount, Value: 1})
+		for index, metric := range stats.Metrics {
+			name := fmt.Sprintf("m%d", index)
+			group = append(group, bson.E{Key: name, Value: bson.M{"$" + string(metric.Accumulator): "$" + metric.Field}})
+			projection = append(projection, bson.E{Key: string(metric.Accumulator) + "." + metric.Field, Value: "$" + name})
+		}
+
+		stages := bson.A{}
+		if len(filter_) != 0 {
+			stages = append(stages, bson.M{"$match": filter_})
+		}
+		stages = append(stages, bson.M{"$group": group}, bson.M{"$sort": bson.M{"_id": 1}})
+		if maxGroups > 0 {
+			// One extra group tells whether the limit was exceeded.
+			stages = append(stages, bson.M{"$limit": maxGroups + 1})
+		}
+		stages = append(stages, bson.M{"$project": projection})
+
+		if cursor, err := collection.Aggregate(ctx.Request().Context(), stages); err != nil {
+			return nil, err
+		} else {
+			results := []bson.M{}
+			if err := cursor.All(ctx.Request().Context(), &results); err != nil {
+				return nil, err
+			}
+			if maxGroups > 0 && int64(len(results)) > maxGroups {
+				return nil, errTooManyGroups
+			}
+			return results, nil
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestStatsParser(t *testing.T) {
+	parse := makeStatsParser(&dsl.Stats{
+		GroupBy:      []string{"name", "_id"},
+		Accumulators: map[string][]dsl.StatsAccumulator{"age": {dsl.StatsSum, dsl.StatsAvg}},
+	}, makeModelFields(queryModel{}))
+	cases := []struct {
+		name     string
+		query    string
+		expected StatsQuery
+		errors   map[string][]string
+	}{
+		{"tells no criteria", "", StatsQuery{}, nil},
+		{
+			"parses groups and metrics", "group_by=name,%20_id&metrics=sum:age,count,avg:age",
+			StatsQuery{
+				GroupBy: []string{"name", "_id"},
+				Metrics: []StatsMetric{{Accumulator: dsl.StatsSum, Field: "age"}, {Accumulator: dsl.StatsAvg, Field: "age"}},
+			}, nil,
+		},
+		{"rejects empty groups", "group_by=name,", StatsQuery{}, map[string][]string{"group_by": {"syntax"}}},
+		{"rejects other groups", "group_by=age", StatsQuery{}, map[string][]string{"group_by.age": {"groupable"}}},
+		{"rejects repeated groups", "group_by=name,name", StatsQuery{}, map[string][]string{"group_by.name": {"unique"}}},
+		{"rejects metrics without fields", "metrics=sum", StatsQuery{}, map[string][]string{"metrics": {"syntax"}}},
+		{"rejects empty accumulators", "metrics=:age", StatsQuery{}, map[string][]string{"metrics": {"syntax"}}},
+		{
+			"rejects accumulators not allowed", "metrics=max:age,sum:name", StatsQuery{},
+			map[string][]string{"metrics.max:age": {"accumulator"}, "metrics.sum:name": {"accumulator"}},
+		},
+		{
+			"rejects repeated metrics", "metrics=sum:age,sum:age", StatsQuery{},
+			map[string][]string{"metrics.sum:age": {"unique"}},
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			ctx, recorder := newTestContext(http.MethodGet, "/?"+case_.query, nil)
+			query, ok, err := parse(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if case_.errors != nil {
+				if ok {
+					t.Fatalf("expected errors %v, got the query %v", case_.errors, query)
+				} else if errors := responseErrors(t, recorder); !reflect.DeepEqual(errors, case_.errors) {
+					t.Fatalf("expected errors %v, got %v", case_.errors, errors)
+				}
+			} else if !ok {
+				t.Fatalf("unexpected errors: %s", recorder.Body.String())
+			} else if !reflect.DeepEqual(query, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, query)
+			}
+		})
+	}
+}
+
+func TestStatsParserUnmappedField(t *testing.T) {
+	cases := []struct {
+		name  string
+		stats dsl.Stats
+	}{
+		{"panics on group fields", dsl.Stats{GroupBy: []string{"missing"}}},
+		{
+			"panics on accumulated fields",
+			dsl.Stats{Accumulators: map[string][]dsl.StatsAccumulator{"missing": {dsl.StatsSum}}},
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic")
+				}
+			}()
+			makeStatsParser(&case_.stats, makeModelFields(queryModel{}))
+		})
+	}
+}
+
+func TestListStatsErrors(t *testing.T) {
+	parseStats := func(echo.Context) (StatsQuery, bool, error) { return StatsQuery{}, true, nil }
+	cases := []struct {
+		name   string
+		err    error
+		errors map[string][]string
+	}{
+		{"rejects proximity criteria", errCountNotSupported, map[string][]string{"near": {"stats"}}},
+		{"rejects too many groups", errTooManyGroups, map[string][]string{"group_by": {"too-many-groups"}}},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			stats := func(echo.Context, ListQuery, StatsQuery) ([]bson.M, error) { return nil, case_.err }
+			ctx, recorder := newTestContext(http.MethodGet, "/", nil)
+			if err := listStats(ctx, stats, parseStats, noFilter, noGeo, false, slog.Default()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if errors := responseErrors(t, recorder); !reflect.DeepEqual(errors, case_.errors) {
+				t.Fatalf("expected errors %v, got %v", case_.errors, errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// deletedField is the field marking the soft-deleted elements.
+	deletedField = "_deleted"
+
+	// deletedAtField is the field holding the time an element was
+	// soft-deleted. Purging is based on it.
+	deletedAtField = "_deleted_at"
+)
+
+// RestoreOneFunc stands for a function that restores a soft-deleted
+// element. It tells whether the element was restored.
+type RestoreOneFunc func(echo.Context, primitive.ObjectID) (bool, error)
+
+// softDeleteUpdate builds the update that soft-deletes elements. It
+// is a write, so the modification time (and the version and revisions,
+// if any) is also updated.
+func softDeleteUpdate(tracking Tracking) bson.M {
+	deletedAt := now()
+	update := bson.M{"$set": bson.M{deletedField: true, deletedAtField: deletedAt, modifiedAtField: deletedAt}}
+	if increments := tracking.increments(); len(increments) != 0 {
+		update["$inc"] = increments
+	}
+	return update
+}
+
+// trashFilter restricts a resource's filter to the soft-deleted
+// elements.
+func trashFilter(filter bson.M) bson.M {
+	return mergeFilter(filter, bson.M{deletedField: true})
+}
+
+// makeRestoreOne makes a function that restores a soft-deleted element.
+// In resources with history, its prior (deleted) version is recorded.
+func makeRestoreOne(
+	collection *mongo.Collection, filter bson.M, tracking Tracking,
+) RestoreOneFunc {
+	return func(ctx echo.Context, id primitive.ObjectID) (bool, error) {
+		var err error
+		var filter_ bson.M
+
+		// Set the ID, only among the soft-deleted elements.
+		if filter_, err = setId(trashFilter(filter), id, false); err != nil {
+			return false, err
+		}
+
+		// Try restoring an element.
+		update := bson.M{
+			"$unset": bson.M{deletedField: "", deletedAtField: ""},
+			"$set":   bson.M{modifiedAtField: now()},
+		}
+		if increments := tracking.increments(); len(increments) != 0 {
+			update["$inc"] = increments
+		}
+		if tracking.Revisions != nil {
+			if previous, err := collection.FindOneAndUpdate(
+				ctx.Request().Context(), filter_, update,
+			).DecodeBytes(); errors.Is(err, mongo.ErrNoDocuments) {
+				return false, nil
+			} else if err != nil {
+				return false, err
+			} else {
+				tracking.record(ctx, previous)
+				return true, nil
+			}
+		} else if result, err := collection.UpdateOne(ctx.Request().Context(), filter_, update); err != nil {
+			return false, err
+		} else {
+			return result.MatchedCount > 0, nil
+		}
+	}
+}
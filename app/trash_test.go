@@ -0,0 +1,87 @@
+package app
+
+import (
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSetId(t *testing.T) {
+	id := primitive.NewObjectID()
+	filter := bson.M{"a": 1}
+	cases := []struct {
+		name       string
+		id         primitive.ObjectID
+		softDelete bool
+		expected   bson.M
+	}{
+		{"keeps the filter without an id", primitive.NilObjectID, false, bson.M{"a": 1}},
+		{"sets the id", id, false, bson.M{"a": 1, "_id": id}},
+		{"skips soft-deleted elements", id, true, bson.M{"a": 1, "_id": id, deletedField: bson.M{"$ne": true}}},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if result, err := setId(filter, case_.id, case_.softDelete); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if !reflect.DeepEqual(result, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, result)
+			}
+		})
+	}
+	if !reflect.DeepEqual(filter, bson.M{"a": 1}) {
+		t.Fatalf("the original filter was changed: %v", filter)
+	}
+}
+
+func TestTrashFilter(t *testing.T) {
+	cases := []struct {
+		name     string
+		filter   bson.M
+		expected bson.M
+	}{
+		{"restricts no filter", nil, bson.M{deletedField: true}},
+		{"restricts the filter", bson.M{"a": 1}, bson.M{"$and": bson.A{bson.M{"a": 1}, bson.M{deletedField: true}}}},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if result := trashFilter(case_.filter); !reflect.DeepEqual(result, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, result)
+			}
+		})
+	}
+}
+
+func TestSoftDeleteUpdate(t *testing.T) {
+	cases := []struct {
+		name       string
+		tracking   Tracking
+		increments any
+	}{
+		{"only marks the elements", Tracking{}, nil},
+		{"increments the version", Tracking{Versioned: true}, bson.M{versionField: 1}},
+		{
+			"increments the version and revision",
+			Tracking{Versioned: true, Revisions: func(ctx echo.Context, previous bson.Raw) {}},
+			bson.M{versionField: 1, revisionField: 1},
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			update := softDeleteUpdate(case_.tracking)
+			set, _ := update["$set"].(bson.M)
+			if set[deletedField] != true {
+				t.Fatalf("expected the elements to be marked, got %v", update)
+			} else if deletedAt, ok := set[deletedAtField].(time.Time); !ok || deletedAt != set[modifiedAtField] {
+				t.Fatalf("expected the deletion and modification times to be the same, got %v", update)
+			} else if !reflect.DeepEqual(update["$inc"], case_.increments) {
+				t.Fatalf("expected the increments %v, got %v", case_.increments, update["$inc"])
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/responses"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// versionField is the field holding the version of the elements,
+	// in versioned resources.
+	versionField = "_version"
+
+	// modifiedAtField is the field holding the time of the last write
+	// of the elements.
+	modifiedAtField = "_modified_at"
+)
+
+// metaFields are the fields holding the metadata of the elements.
+// They are always retrieved (when present), even if the projection
+// does not expose them.
+var metaFields = []string{versionField, modifiedAtField}
+
+// ElementMeta stands for the metadata of a stored element, which is
+// not part of its model type. The version is 0 for elements that are
+// not versioned, and also for the elements of versioned resources that
+// were stored before the resource was versioned (Versioned tells them
+// apart). The modification time is zero for elements that were not
+// written by this app.
+type ElementMeta struct {
+	Version    int64
+	Versioned  bool
+	ModifiedAt time.Time
+}
+
+// fields returns the fields to store for this metadata.
+func (meta ElementMeta) fields() []bson.E {
+	fields := []bson.E{{Key: modifiedAtField, Value: meta.ModifiedAt}}
+	if meta.Version > 0 {
+		fields = append(fields, bson.E{Key: versionField, Value: meta.Version})
+	}
+	return fields
+}
+
+// now returns the current time, as precise as it can be stored.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// IfMatchReaderFunc stands for a function that reads the versions
+// given in the If-Match header. It returns nil versions when there is
+// no condition on them.
+type IfMatchReaderFunc func(echo.Context) ([]int64, bool, error)
+
+// BumpVersionFunc stands for a function that increments the version
+// of an element, given its id and the expected versions (if any). It
+// tells the new metadata, and whether the element was found.
+type BumpVersionFunc func(echo.Context, primitive.ObjectID, []int64) (ElementMeta, bool, error)
+
+// readMeta reads the metadata of a raw document.
+func readMeta(raw bson.Raw) ElementMeta {
+	meta := ElementMeta{}
+	if value, err := raw.LookupErr(versionField); err == nil {
+		meta.Version, _ = value.AsInt64OK()
+	}
+	if value, err := raw.LookupErr(modifiedAtField); err == nil {
+		if modifiedAt, ok := value.TimeOK(); ok {
+			meta.ModifiedAt = modifiedAt.UTC()
+		}
+	}
+	return meta
+}
+
+// withFields converts an element to a document, setting the given
+// fields in it (replacing them, if present).
+func withFields(content any, fields ...bson.E) (bson.D, error) {
+	var document bson.D
+	if raw, err := bson.Marshal(content); err != nil {
+		return nil, err
+	} else if err := bson.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		replaced := false
+		for index, element := range document {
+			if element.Key == field.Key {
+				document[index].Value = field.Value
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			document = append(document, field)
+		}
+	}
+	return document, nil
+}
+
+// withVersions adds a condition on the version to a filter, when
+// there are expected versions. The version 0 stands for the elements
+// with no version yet (stored before the resource was versioned).
+func withVersions(filter bson.M, versions []int64) bson.M {
+	if versions == nil {
+		return filter
+	}
+	values := bson.A{}
+	for _, version := range versions {
+		values = append(values, version)
+	}
+	if slices.Contains(versions, 0) {
+		values = append(values, nil)
+	}
+	return mergeFilter(filter, bson.M{versionField: bson.M{"$in": values}})
+}
+
+// etag renders a version as an entity tag.
+func etag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// setETag sets the ETag header from the metadata of an element, if
+// it is versioned.
+func setETag(ctx echo.Context, meta ElementMeta) {
+	if meta.Versioned || meta.Version > 0 {
+		ctx.Response().Header().Set("ETag", etag(meta.Version))
+	}
+}
+
+// makeIfMatchReader makes a function that reads the versions given in
+// the If-Match header, for versioned resources (otherwise, the header
+// is ignored). A "*" means any version, while weak or invalid entity
+// tags never match. When required, a missing header is rejected.
+func makeIfMatchReader(versioned, required bool) IfMatchReaderFunc {
+	return func(ctx echo.Context) ([]int64, bool, error) {
+		if !versioned {
+			return nil, true, nil
+		}
+
+		header := strings.TrimSpace(ctx.Request().Header.Get("If-Match"))
+		if header == "" {
+			if required {
+				return nil, false, responses.PreconditionRequired(ctx)
+			}
+			return nil, true, nil
+		} else if header == "*" {
+			return nil, true, nil
+		}
+
+		versions := []int64{}
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimSpace(tag)
+			if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+				continue
+			}
+			if version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64); err == nil {
+				versions = append(versions, version)
+			}
+		}
+		return versions, true, nil
+	}
+}
+
+// versionedGetOne wraps a function that gets one element of a versioned
+// resource, so its metadata tells it is versioned (even if the element
+// has no version yet).
+func versionedGetOne(getOne GetOneFunc) GetOneFunc {
+	return func(ctx echo.Context, id primitive.ObjectID, fields ...string) (any, ElementMeta, error) {
+		element, meta, err := getOne(ctx, id, fields...)
+		meta.Versioned = true
+		return element, meta, err
+	}
+}
+
+// makeBumpVersion makes a function that increments the version of
+// an element, also updating its modification time, provided it has
+// one of the expected versions (if any). It tells the new metadata
+// and whether the element was found.
+func makeBumpVersion(collection *mongo.Collection, filter bson.M, softDelete bool) BumpVersionFunc {
+	return func(ctx echo.Context, id primitive.ObjectID, versions []int64) (ElementMeta, bool, error) {
+		options_ := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(
+			bson.M{versionField: 1, modifiedAtField: 1},
+		)
+		if filter_, err := setId(filter, id, softDelete); err != nil {
+			return ElementMeta{}, false, err
+		} else if raw, err := collection.FindOneAndUpdate(
+			ctx.Request().Context(), withVersions(filter_, versions),
+			bson.M{"$inc": bson.M{versionField: 1}, "$set": bson.M{modifiedAtField: now()}}, options_,
+		).DecodeBytes(); errors.Is(err, mongo.ErrNoDocuments) {
+			return ElementMeta{}, false, nil
+		} else if err != nil {
+			return ElementMeta{}, false, err
+		} else {
+			return readMeta(raw), true, nil
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIfMatchReader(t *testing.T) {
+	cases := []struct {
+		name      string
+		versioned bool
+		required  bool
+		header    string
+		expected  []int64
+		status    int
+	}{
+		{"ignores the header when not versioned", false, true, `"1"`, nil, 0},
+		{"tells no condition without the header", true, false, "", nil, 0},
+		{"requires the header", true, true, "", nil, http.StatusPreconditionRequired},
+		{"tells no condition for any version", true, true, " * ", nil, 0},
+		{"parses versions", true, true, `"1", "3"`, []int64{1, 3}, 0},
+		{"parses the version 0", true, false, `"0"`, []int64{0}, 0},
+		{"ignores weak tags", true, false, `W/"1", "2"`, []int64{2}, 0},
+		{"ignores invalid tags", true, false, `"x", 1, "`, []int64{}, 0},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			header := map[string]string{}
+			if case_.header != "" {
+				header["If-Match"] = case_.header
+			}
+			ctx, recorder := newTestContext(http.MethodPut, "/", header)
+			versions, ok, err := makeIfMatchReader(case_.versioned, case_.required)(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if case_.status != 0 {
+				if ok {
+					t.Fatalf("expected status %d, got the versions %v", case_.status, versions)
+				} else if recorder.Code != case_.status {
+					t.Fatalf("expected status %d, got %d", case_.status, recorder.Code)
+				}
+			} else if !ok {
+				t.Fatalf("unexpected response: %s", recorder.Body.String())
+			} else if !reflect.DeepEqual(versions, case_.expected) {
+				t.Fatalf("expected %#v, got %#v", case_.expected, versions)
+			}
+		})
+	}
+}
+
+func TestWithVersions(t *testing.T) {
+	filter := bson.M{"a": 1}
+	in := func(values ...any) bson.M {
+		return bson.M{"$and": bson.A{filter, bson.M{versionField: bson.M{"$in": append(bson.A{}, values...)}}}}
+	}
+	cases := []struct {
+		name     string
+		versions []int64
+		expected bson.M
+	}{
+		{"keeps the filter without versions", nil, filter},
+		{"matches nothing for no versions", []int64{}, in()},
+		{"matches the versions", []int64{1, 2}, in(int64(1), int64(2))},
+		{"matches missing versions for 0", []int64{0}, in(int64(0), nil)},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if result := withVersions(filter, case_.versions); !reflect.DeepEqual(result, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, result)
+			}
+		})
+	}
+}
+
+func TestSetETag(t *testing.T) {
+	cases := []struct {
+		name     string
+		meta     ElementMeta
+		expected string
+	}{
+		{"sets no tag when not versioned", ElementMeta{}, ""},
+		{"sets the version", ElementMeta{Version: 3}, `"3"`},
+		{"sets the version 0 when versioned", ElementMeta{Versioned: true}, `"0"`},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			ctx, recorder := newTestContext(http.MethodGet, "/", nil)
+			if setETag(ctx, case_.meta); recorder.Header().Get("ETag") != case_.expected {
+				t.Fatalf("expected %q, got %q", case_.expected, recorder.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestDeleteItemPreconditions(t *testing.T) {
+	cases := []struct {
+		name    string
+		header  string
+		deleted bool
+		found   bool
+		status  int
+		code    string
+	}{
+		{"requires the If-Match header", "", false, true, http.StatusPreconditionRequired, "precondition:required"},
+		{"deletes matching versions", `"2"`, true, true, http.StatusOK, "ok"},
+		{"deletes any version", "*", true, true, http.StatusOK, "ok"},
+		{"rejects other versions", `"1"`, false, true, http.StatusPreconditionFailed, "precondition:failed"},
+		{"tells missing elements", `"1"`, false, false, http.StatusNotFound, "not-found"},
+		{"tells missing elements for any version", "*", false, true, http.StatusNotFound, "not-found"},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			deleteOne := func(echo.Context, primitive.ObjectID, []int64) (bool, error) { return case_.deleted, nil }
+			getOne := func(echo.Context, primitive.ObjectID, ...string) (any, ElementMeta, error) {
+				if case_.found {
+					return &queryModel{}, ElementMeta{Version: 2}, nil
+				}
+				return nil, ElementMeta{}, mongo.ErrNoDocuments
+			}
+			header := map[string]string{}
+			if case_.header != "" {
+				header["If-Match"] = case_.header
+			}
+			ctx, recorder := newTestContext(http.MethodDelete, "/", header)
+			if err := deleteItem(
+				ctx, deleteOne, getOne, makeIfMatchReader(true, true), nil, primitive.NewObjectID(), slog.Default(),
+			); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if recorder.Code != case_.status {
+				t.Fatalf("expected status %d, got %d", case_.status, recorder.Code)
+			} else if !strings.Contains(recorder.Body.String(), `"code":"`+case_.code+`"`) {
+				t.Fatalf("expected the code %s, got %s", case_.code, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package app
+
+import (
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"strings"
+)
+
+// PipelineBinderFunc is a function that replaces the parameter
+// placeholders in a pipeline with the values of the given (bound
+// and validated) parameters object.
+type PipelineBinderFunc func(any) bson.A
+
+// bindPipelineValue replaces the parameter placeholders in a value.
+func bindPipelineValue(value any, params map[string]any) any {
+	switch v := value.(type) {
+	case dsl.PipelineParam:
+		return params[string(v)]
+	case bson.A:
+		result := make(bson.A, len(v))
+		for index, item := range v {
+			result[index] = bindPipelineValue(item, params)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for index, item := range v {
+			result[index] = bindPipelineValue(item, params)
+		}
+		return result
+	case bson.M:
+		result := bson.M{}
+		for key, item := range v {
+			result[key] = bindPipelineValue(item, params)
+		}
+		return result
+	case map[string]any:
+		result := map[string]any{}
+		for key, item := range v {
+			result[key] = bindPipelineValue(item, params)
+		}
+		return result
+	case bson.D:
+		result := make(bson.D, len(v))
+		for index, item := range v {
+			result[index] = bson.E{Key: item.Key, Value: bindPipelineValue(item.Value, params)}
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// pipelineParams collects the names of the parameter placeholders
+// used in a value.
+func pipelineParams(value any, names map[string]bool) {
+	switch v := value.(type) {
+	case dsl.PipelineParam:
+		names[string(v)] = true
+	case bson.A:
+		for _, item := range v {
+			pipelineParams(item, names)
+		}
+	case []any:
+		for _, item := range v {
+			pipelineParams(item, names)
+		}
+	case bson.M:
+		for _, item := range v {
+			pipelineParams(item, names)
+		}
+	case map[string]any:
+		for _, item := range v {
+			pipelineParams(item, names)
+		}
+	case bson.D:
+		for _, item := range v {
+			pipelineParams(item.Value, names)
+		}
+	}
+}
+
+// makePipelineBinder makes a function that binds the parameters into
+// a pipeline. The parameters are taken from the fields of the given
+// parameters type, by their `query` tag (fields without that tag are
+// not bound). Every placeholder must refer to an existing parameter.
+func makePipelineBinder(pipeline bson.A, parametersType dsl.ModelTypeFunction) PipelineBinderFunc {
+	fieldIndices := map[string]int{}
+	if parametersType != nil {
+		typ := reflect.TypeOf(parametersType())
+		if typ.Kind() != reflect.Struct {
+			panic("the parameters type is not a struct: " + typ.Name())
+		}
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if name := strings.SplitN(field.Tag.Get("query"), ",", 2)[0]; name != "" {
+				fieldIndices[name] = i
+			}
+		}
+	}
+
+	names := map[string]bool{}
+	pipelineParams(pipeline, names)
+	for name := range names {
+		if _, ok := fieldIndices[name]; !ok {
+			panic("the pipeline parameter is not defined in the parameters type: " + name)
+		}
+	}
+
+	return func(params any) bson.A {
+		values := map[string]any{}
+		if params != nil {
+			val := reflect.ValueOf(params).Elem()
+			for name, index := range fieldIndices {
+				values[name] = val.Field(index).Interface()
+			}
+		}
+		return bindPipelineValue(pipeline, values).(bson.A)
+	}
+}
+
+// makeViewGetMany makes a function that, given the bound parameters,
+// makes a function that returns many elements from a view resource,
+// according to the client-provided criteria. The resource's filter is
+// applied before the pipeline, while the client-provided criteria are
+// applied to the pipeline's results.
+func makeViewGetMany(
+	collection *mongo.Collection, make func() any, softDelete bool,
+	filter bson.M, projection bson.M, sort bson.D, bindPipeline PipelineBinderFunc,
+	encodeCursor CursorEncoderFunc, decodeCursor CursorDecoderFunc,
+) func(any) GetManyFunc {
+	return func(params any) GetManyFunc {
+		return func(ctx echo.Context, query ListQuery) ([]any, string, error) {
+			var err error
+			var filter_ bson.M
+
+			// Set the ID.
+			if filter_, err = setId(filter, primitive.NilObjectID, softDelete); err != nil {
+				return nil, "", err
+			}
+
+			// Prepare the stages.
+			stages := bson.A{}
+			if len(filter_) != 0 {
+				stages = append(stages, bson.M{"$match": filter_})
+			}
+			stages = append(stages, bindPipeline(params)...)
+			if len(query.Filter) != 0 {
+				stages = append(stages, bson.M{"$match": query.Filter})
+			}
+
+			// Choose the sort criteria.
+			sort_ := withTiebreaker(sort)
+			if query.Sort != nil {
+				sort_ = withTiebreaker(query.Sort)
+			}
+
+			// Paginate and project the results.
+			projection_, hidden := narrowProjection(projection, query.Fields)
+			if query.UseCursor {
+				var hiddenSortKeys []string
+				projection_, hiddenSortKeys = exposeFields(projection_, sortKeys(sort_))
+				hidden = append(hidden, hiddenSortKeys...)
+				if query.Cursor != "" {
+					if values, err := decodeCursor(sort_, query.Cursor); err != nil {
+						return nil, "", err
+					} else {
+						stages = append(stages, bson.M{"$match": cursorFilter(sort_, values)})
+					}
+				}
+			}
+			stages = append(stages, bson.M{"$sort": sort_})
+			if query.PageSize > 0 {
+				if query.UseCursor {
+					stages = append(stages, bson.M{"$limit": query.PageSize + 1})
+				} else {
+					if query.Page > 0 {
+						stages = append(stages, bson.M{"$skip": query.Page * query.PageSize})
+					}
+					stages = append(stages, bson.M{"$limit": query.PageSize})
+				}
+			}
+			if len(projection_) != 0 {
+				stages = append(stages, bson.M{"$project": projection_})
+			}
+
+			if cursor, err := collection.Aggregate(ctx.Request().Context(), stages); err != nil {
+				return nil, "", err
+			} else {
+				return decodeMany(ctx, cursor, make, hidden, query, sort_, encodeCursor)
+			}
+		}
+	}
+}
+
+// makeViewCount makes a function that, given the bound parameters,
+// makes a function that counts the elements of a view resource that
+// match the client-provided criteria.
+func makeViewCount(
+	collection *mongo.Collection, softDelete bool, filter bson.M, bindPipeline PipelineBinderFunc,
+) func(any) CountFunc {
+	return func(params any) CountFunc {
+		return func(ctx echo.Context, query ListQuery) (int64, error) {
+			var err error
+			var filter_ bson.M
+
+			// Set the ID.
+			if filter_, err = setId(filter, primitive.NilObjectID, softDelete); err != nil {
+				return 0, err
+			}
+
+			// Prepare the stages.
+			stages := bson.A{}
+			if len(filter_) != 0 {
+				stages = append(stages, bson.M{"$match": filter_})
+			}
+			stages = append(stages, bindPipeline(params)...)
+			if len(query.Filter) != 0 {
+				stages = append(stages, bson.M{"$match": query.Filter})
+			}
+			stages = append(stages, bson.M{"$count": "count"})
+
+			if cursor, err := collection.Aggregate(ctx.Request().Context(), stages); err != nil {
+				return 0, err
+			} else {
+				defer func(cursor *mongo.Cursor, ctx echo.Context) {
+					_ = cursor.Close(ctx.Request().Context())
+				}(cursor, ctx)
+				var result struct {
+					Count int64 `bson:"count"`
+				}
+				if cursor.Next(ctx.Request().Context()) {
+					if err := cursor.Decode(&result); err != nil {
+						return 0, err
+					}
+				}
+				return result.Count, cursor.Err()
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"testing"
+)
+
+// viewParams is the parameters type used to test the pipeline binders.
+type viewParams struct {
+	Min   int    `query:"min"`
+	Tag   string `query:"tag,omitempty"`
+	Other string
+}
+
+func TestBindPipelineValue(t *testing.T) {
+	params := map[string]any{"min": 3, "tag": "x"}
+	cases := []struct {
+		name     string
+		value    any
+		expected any
+	}{
+		{"keeps other values", "$min", "$min"},
+		{"binds placeholders", dsl.Param("min"), 3},
+		{"binds missing placeholders to nil", dsl.Param("max"), nil},
+		{"binds inside arrays", bson.A{dsl.Param("tag"), 1}, bson.A{"x", 1}},
+		{"binds inside slices", []any{dsl.Param("tag")}, []any{"x"}},
+		{
+			"binds inside documents", bson.M{"$match": bson.M{"n": bson.M{"$gte": dsl.Param("min")}}},
+			bson.M{"$match": bson.M{"n": bson.M{"$gte": 3}}},
+		},
+		{"binds inside maps", map[string]any{"tag": dsl.Param("tag")}, map[string]any{"tag": "x"}},
+		{
+			"binds inside ordered documents", bson.D{{Key: "$limit", Value: dsl.Param("min")}},
+			bson.D{{Key: "$limit", Value: 3}},
+		},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			if value := bindPipelineValue(case_.value, params); !reflect.DeepEqual(value, case_.expected) {
+				t.Fatalf("expected %v, got %v", case_.expected, value)
+			}
+		})
+	}
+}
+
+func TestPipelineBinder(t *testing.T) {
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"n": bson.M{"$gte": dsl.Param("min")}, "tags": dsl.Param("tag")}},
+	}
+	bind := makePipelineBinder(pipeline, dsl.ModelType[viewParams])
+	expected := bson.A{bson.M{"$match": bson.M{"n": bson.M{"$gte": 3}, "tags": "x"}}}
+	if bound := bind(&viewParams{Min: 3, Tag: "x"}); !reflect.DeepEqual(bound, expected) {
+		t.Fatalf("expected %v, got %v", expected, bound)
+	} else if _, ok := pipeline[0].(bson.M)["$match"].(bson.M)["tags"].(dsl.PipelineParam); !ok {
+		t.Fatalf("the original pipeline was changed: %v", pipeline)
+	}
+}
+
+func TestPipelineBinderMisconfiguration(t *testing.T) {
+	cases := []struct {
+		name           string
+		pipeline       bson.A
+		parametersType dsl.ModelTypeFunction
+	}{
+		{"panics without a parameters type", bson.A{bson.M{"$limit": dsl.Param("min")}}, nil},
+		{"panics on untagged fields", bson.A{bson.M{"$limit": dsl.Param("Other")}}, dsl.ModelType[viewParams]},
+		{"panics on other types than structs", bson.A{}, dsl.ModelType[int]},
+	}
+
+	for _, case_ := range cases {
+		t.Run(case_.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic")
+				}
+			}()
+			makePipelineBinder(case_.pipeline, case_.parametersType)
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package dsl
+
+import (
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/formats"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit holds the fields maintained in audited resources. Model types
+// embed it (with `bson:",inline"`) to expose them. Those fields are set
+// by the server, and any client-provided value for them is ignored.
+type Audit struct {
+	CreatedAt *formats.DateTime   `bson:"created_at,omitempty" json:"created_at,omitempty"`
+	CreatedBy *primitive.ObjectID `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	UpdatedAt *formats.DateTime   `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+	UpdatedBy *primitive.ObjectID `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+}
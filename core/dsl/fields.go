@@ -0,0 +1,23 @@
+package dsl
+
+// FieldMode tells how the clients can access a field of the model.
+type FieldMode uint
+
+const (
+	// ReadOnlyField stands for a field the clients never set. Their
+	// values are ignored on creation and replacement (the stored value
+	// is kept), and patching the field is forbidden.
+	ReadOnlyField FieldMode = iota
+	// ImmutableField stands for a field the clients can set only while
+	// it is absent (e.g. on creation). Afterwards, it is kept on any
+	// replacement, and patching the field is forbidden.
+	ImmutableField
+	// WriteOnlyField stands for a field (e.g. a secret) that is never
+	// rendered in the responses.
+	WriteOnlyField
+)
+
+// FieldModes maps the fields of the model (by their BSON name) to
+// how the clients can access them. The unlisted fields can be read
+// and written freely.
+type FieldModes map[string]FieldMode
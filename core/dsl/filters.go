@@ -0,0 +1,21 @@
+package dsl
+
+// FilterOperator is an operator that can be used by the clients
+// to filter the elements of a list resource by a given field.
+type FilterOperator string
+
+const (
+	FilterEq     FilterOperator = "eq"
+	FilterNe     FilterOperator = "ne"
+	FilterGt     FilterOperator = "gt"
+	FilterGte    FilterOperator = "gte"
+	FilterLt     FilterOperator = "lt"
+	FilterLte    FilterOperator = "lte"
+	FilterIn     FilterOperator = "in"
+	FilterNin    FilterOperator = "nin"
+	FilterExists FilterOperator = "exists"
+)
+
+// Filterable maps a field name (as mapped in BSON by the model
+// type) to the operators the clients can use on it.
+type Filterable map[string][]FilterOperator
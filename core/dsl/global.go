@@ -1,15 +1,29 @@
 package dsl
 
+import "crypto/rand"
+
 const DefaultListMaxSize int64 = 20
 
 // Global stands for settings for ALL the resources.
 type Global struct {
+	// ListMaxResults is the maximum page size for the list
+	// resources that do not define their own maximum.
 	ListMaxResults int64
+	// CursorSecret is the key used to sign the pagination
+	// cursors. When not set, a random one is generated on
+	// each startup, so cursors do not survive restarts.
+	CursorSecret []byte
 }
 
 // Prepare installs the default values in the global settings.
 func (global *Global) Prepare() {
-	if global.ListMaxResults == 0 {
-		global.ListMaxResults = 1
+	if global.ListMaxResults <= 0 {
+		global.ListMaxResults = DefaultListMaxSize
+	}
+	if len(global.CursorSecret) == 0 {
+		global.CursorSecret = make([]byte, 32)
+		if _, err := rand.Read(global.CursorSecret); err != nil {
+			panic(err)
+		}
 	}
 }
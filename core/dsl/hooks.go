@@ -0,0 +1,58 @@
+package dsl
+
+import (
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/auth"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CreateHook is a hook invoked before an element is created. It
+// can modify the element (e.g. to derive some of its fields).
+type CreateHook func(
+	context echo.Context, token *auth.AuthToken, collection *mongo.Collection, element any,
+) error
+
+// ElementHook is a hook invoked on an element (which can be
+// modified, if the hook runs before the element is written),
+// given its id.
+type ElementHook func(
+	context echo.Context, token *auth.AuthToken, collection *mongo.Collection, id primitive.ObjectID, element any,
+) error
+
+// UpdateHook is a hook invoked before an element is updated,
+// given its id, its current contents and its updated contents
+// (which can be modified).
+type UpdateHook func(
+	context echo.Context, token *auth.AuthToken, collection *mongo.Collection, id primitive.ObjectID,
+	old, new any,
+) error
+
+// DeleteHook is a hook invoked on an element being deleted,
+// given its id.
+type DeleteHook func(
+	context echo.Context, token *auth.AuthToken, collection *mongo.Collection, id primitive.ObjectID,
+) error
+
+// Hooks are the functions invoked around the writes performed by
+// the standard endpoints of a resource. A hook aborts the request
+// by returning an error: a *responses.Error is rendered as it is,
+// while any other error is rendered as an internal error. A hook
+// might also render the response by itself. The Before* hooks get
+// an element which is already valid and, since they can change it
+// (e.g. to derive some of its fields), the element is validated
+// again after they run: if it is not valid anymore, it is not
+// written and the validation errors are rendered. When an After*
+// hook aborts, the write is not undone. In bulk creations, an
+// aborting AfterCreate hook only fails its element, and the result
+// of the other elements is still rendered. In simple resources, the
+// id of the element is the nil id (except for AfterCreate).
+type Hooks struct {
+	BeforeCreate  CreateHook
+	AfterCreate   ElementHook
+	BeforeReplace ElementHook
+	BeforeUpdate  UpdateHook
+	AfterUpdate   ElementHook
+	BeforeDelete  DeleteHook
+	AfterDelete   DeleteHook
+}
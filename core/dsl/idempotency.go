@@ -0,0 +1,41 @@
+package dsl
+
+import "time"
+
+// DefaultIdempotencyTTL is the default time the responses of the
+// requests made with an idempotency key are kept.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// DefaultIdempotencyLease is the default time an idempotency key is
+// held while its request is being processed.
+const DefaultIdempotencyLease = time.Minute
+
+// Idempotency is a table reference used to store the responses of
+// the requests made with an Idempotency-Key header, so they can be
+// replayed when those requests are retried.
+type Idempotency struct {
+	TableRef
+	// TTL is the time the responses are kept (and replayed).
+	TTL time.Duration `validate:"min=0"`
+	// Lease is the time a key is held while its request is being
+	// processed. If the request does not finish by then (e.g. the
+	// server crashed), the key can be claimed again. It must be
+	// longer than the time any request takes.
+	Lease time.Duration `validate:"min=0"`
+}
+
+// Prepare installs default values in the idempotency settings.
+func (idempotency *Idempotency) Prepare() {
+	if idempotency.Db == "" {
+		idempotency.Db = "alephvault_http_storage"
+	}
+	if idempotency.Collection == "" {
+		idempotency.Collection = "idempotency"
+	}
+	if idempotency.TTL <= 0 {
+		idempotency.TTL = DefaultIdempotencyTTL
+	}
+	if idempotency.Lease <= 0 {
+		idempotency.Lease = DefaultIdempotencyLease
+	}
+}
@@ -1,7 +1,39 @@
 package dsl
 
-// Index is the description of a MongoDB index.
+// Index is the description of a MongoDB index. Each field
+// might be prefixed to tell its index type: "-" (descending),
+// "@" (2dsphere), "#" (hashed) or "~" (text). Otherwise, the
+// field is indexed in ascending order.
 type Index struct {
 	Unique bool
 	Fields []string `validate:"required,dive,required,mdb-index-entry"`
 }
+
+// HasTextIndex tells whether any of the given indexes involves
+// a text field (which enables full-text search).
+func HasTextIndex(indexes map[string]Index) bool {
+	for _, index := range indexes {
+		for _, field := range index.Fields {
+			if len(field) > 0 && field[0] == '~' {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GeoIndexFields returns the fields involved in 2dsphere
+// indexes (which enable geospatial queries).
+func GeoIndexFields(indexes map[string]Index) []string {
+	var fields []string
+	seen := map[string]bool{}
+	for _, index := range indexes {
+		for _, field := range index.Fields {
+			if len(field) > 0 && field[0] == '@' && !seen[field[1:]] {
+				seen[field[1:]] = true
+				fields = append(fields, field[1:])
+			}
+		}
+	}
+	return fields
+}
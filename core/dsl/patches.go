@@ -0,0 +1,30 @@
+package dsl
+
+// PatchOperator is an update operator that can be used by the clients
+// in the body of a PATCH request.
+type PatchOperator string
+
+const (
+	PatchSet      PatchOperator = "$set"
+	PatchUnset    PatchOperator = "$unset"
+	PatchInc      PatchOperator = "$inc"
+	PatchMul      PatchOperator = "$mul"
+	PatchMin      PatchOperator = "$min"
+	PatchMax      PatchOperator = "$max"
+	PatchPush     PatchOperator = "$push"
+	PatchPull     PatchOperator = "$pull"
+	PatchAddToSet PatchOperator = "$addToSet"
+	PatchRename   PatchOperator = "$rename"
+)
+
+// PatchPolicy tells which update operators the clients can use in the
+// body of a PATCH request, and which fields (as mapped in BSON by the
+// model type, or dotted paths inside them) they can write. Writing to
+// a field also allows writing to any path inside it. By default, all
+// the operators are allowed and all the fields of the model type (but
+// the _id) can be written or, if the resource has an input type, only
+// those also present (with the same BSON name) in the input type.
+type PatchPolicy struct {
+	Operators []PatchOperator `validate:"dive,oneof=$set $unset $inc $mul $min $max $push $pull $addToSet $rename"`
+	Paths     []string        `validate:"dive,required"`
+}
@@ -3,19 +3,23 @@ package dsl
 import (
 	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/bson"
+	"time"
 )
 
 // ResourceType is an enumeration to tell whether it is a list
-// resource (standard) or one with just one record.
+// resource (standard), one with just one record, or a read-only
+// list resource backed by an aggregation pipeline.
 type ResourceType uint
 
 const (
 	ListResource ResourceType = iota
 	SimpleResource
+	ViewResource
 )
 
 // ResourceVerb is an enumeration to tell the allowed verbs into
-// these resources: list, create, read, replace, update, delete.
+// these resources: list, create, read, replace, update, delete,
+// count, distinct, bulk create, bulk update, bulk delete.
 type ResourceVerb uint
 
 const (
@@ -25,7 +29,12 @@ const (
 	ReplaceVerb
 	UpdateVerb
 	DeleteVerb
-	LastVerb = DeleteVerb
+	CountVerb
+	DistinctVerb
+	BulkCreateVerb
+	BulkUpdateVerb
+	BulkDeleteVerb
+	LastVerb = BulkDeleteVerb
 )
 
 // ModelTypeFunction is a function that returns the model to use.
@@ -38,22 +47,53 @@ func ModelType[T any]() interface{} {
 	return t
 }
 
+// InputMapping is a function that fills an element of the model type
+// from an element of the input type (both given as pointers).
+type InputMapping func(input, element any) error
+
+// OutputMapping is a function that fills an element of the output type
+// from an element of the model type (both given as pointers).
+type OutputMapping func(element, output any) error
+
 // Resource stands for the rules regarding a particular
 // resource (in the end, a collection).
 type Resource struct {
 	TableRef       `validate:"dive"`
-	Type           ResourceType `validate:"min=0,max=1"`
+	Type           ResourceType `validate:"min=0,max=2"`
 	Sort           bson.D
 	Filter         bson.M
-	ItemProjection bson.M `validate:"excluded_if=Type 1"`
+	ItemProjection bson.M `validate:"excluded_unless=Type 0"`
 	Projection     bson.M
-	ItemMethods    map[string]ItemMethod     `validate:"excluded_if=Type 1,dive,keys,method-name,endkeys,dive"`
-	Methods        map[string]ResourceMethod `validate:"dive,keys,method-name,endkeys,dive"`
+	ItemMethods    map[string]ItemMethod     `validate:"excluded_unless=Type 0,dive,keys,method-name,endkeys,dive"`
+	Methods        map[string]ResourceMethod `validate:"excluded_if=Type 2,dive,keys,method-name,endkeys,dive"`
 	ModelType      ModelTypeFunction         `validate:"required"`
 	Verbs          []ResourceVerb            `validate:"dive,verbs"`
 	SoftDelete     bool
 	ListMaxResults uint
-	Indexes        map[string]Index `validate:"dive,keys,mdb-name,endkeys"`
+	Indexes        map[string]Index  `validate:"dive,keys,mdb-name,endkeys"`
+	Filterable     Filterable        `validate:"excluded_if=Type 1,dive,keys,required,endkeys,dive,oneof=eq ne gt gte lt lte in nin exists"`
+	Sortable       []string          `validate:"excluded_if=Type 1,dive,required"`
+	ListCount      bool              `validate:"excluded_if=Type 1"`
+	ListEnvelope   bool              `validate:"excluded_if=Type 1"`
+	Pipeline       bson.A            `validate:"required_iif=Type 2"`
+	Parameters     ModelTypeFunction `validate:"excluded_unless=Type 2"`
+	Distinct       []string          `validate:"excluded_unless=Type 0,dive,required"`
+	Stats          *Stats            `validate:"excluded_unless=Type 0"`
+	BulkMaxSize    uint              `validate:"excluded_unless=Type 0"`
+	PatchPolicy    *PatchPolicy      `validate:"excluded_if=Type 2"`
+	Versioned      bool              `validate:"excluded_if=Type 2"`
+	RequireIfMatch bool              `validate:"excluded_unless=Versioned true"`
+	CacheTTL       time.Duration     `validate:"excluded_unless=Type 1,min=0"`
+	AllowUpsert    bool              `validate:"excluded_unless=Type 0"`
+	PurgeAfter     time.Duration     `validate:"omitempty,excluded_if=Type 2,excluded_unless=SoftDelete true,min=1s"`
+	Audited        bool              `validate:"excluded_if=Type 2"`
+	Hooks          *Hooks            `validate:"excluded_if=Type 2"`
+	History        bool              `validate:"excluded_unless=Type 0"`
+	FieldModes     FieldModes        `validate:"excluded_if=Type 2,dive,keys,required,endkeys,min=0,max=2"`
+	InputType      ModelTypeFunction `validate:"excluded_if=Type 2"`
+	FromInput      InputMapping      `validate:"required_with=InputType,excluded_without=InputType"`
+	OutputType     ModelTypeFunction `validate:"excluded_if=Type 2"`
+	ToOutput       OutputMapping     `validate:"required_with=OutputType,excluded_without=OutputType"`
 }
 
 // Resources belong to a mapping.
@@ -61,16 +101,22 @@ type Resources map[string]Resource
 
 // ValidateVerbs does a custom validation function on the verbs:
 // If the resource is of list type ListResource then allow all
-// the verbs. Otherwise, allow all but the List verb.
+// the verbs. If it is of type ViewResource then only allow the
+// List verb. Otherwise, allow all but the List, Count, Distinct
+// and the Bulk* verbs.
 func ValidateVerbs(fl validator.FieldLevel) bool {
 	resource := fl.Parent().Interface().(Resource)
 
 	for _, verb := range resource.Verbs {
-		if resource.Type == ListResource && (verb > 5) {
+		if resource.Type == ListResource && (verb > LastVerb) {
+			return false
+		}
+
+		if resource.Type == SimpleResource && (verb == ListVerb || verb >= CountVerb) {
 			return false
 		}
 
-		if resource.Type == SimpleResource && (verb == ListVerb || verb > LastVerb) {
+		if resource.Type == ViewResource && verb != ListVerb {
 			return false
 		}
 	}
@@ -0,0 +1,25 @@
+package dsl
+
+// StatsAccumulator is an accumulator that can be used by the clients
+// to compute statistics of a field, for each group of elements of a
+// list resource.
+type StatsAccumulator string
+
+const (
+	StatsSum StatsAccumulator = "sum"
+	StatsAvg StatsAccumulator = "avg"
+	StatsMin StatsAccumulator = "min"
+	StatsMax StatsAccumulator = "max"
+)
+
+// Stats tells which statistics the clients can compute over a list
+// resource: the fields (as mapped in BSON by the model type) they can
+// group the elements by, and the accumulators they can use on each
+// field. Counting the elements of each group is always allowed. When
+// there are more than MaxGroups groups (by default, the same maximum
+// of the list results), the query is rejected instead of truncated.
+type Stats struct {
+	GroupBy      []string                      `validate:"required,dive,required"`
+	Accumulators map[string][]StatsAccumulator `validate:"dive,keys,required,endkeys,dive,oneof=sum avg min max"`
+	MaxGroups    uint
+}
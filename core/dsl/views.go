@@ -0,0 +1,12 @@
+package dsl
+
+// PipelineParam is a placeholder, in the pipeline of a view
+// resource, for the value of one of its parameters. The name
+// is the one of the query string parameter, as bound by the
+// view's Parameters type (i.e. its `query` tag).
+type PipelineParam string
+
+// Param creates a placeholder for a parameter in a pipeline.
+func Param(name string) PipelineParam {
+	return PipelineParam(name)
+}
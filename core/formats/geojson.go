@@ -0,0 +1,166 @@
+package formats
+
+import (
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// geoJSON is the raw form of a GeoJSON geometry.
+type geoJSON[T any] struct {
+	Type        string `json:"type" bson:"type"`
+	Coordinates T      `json:"coordinates" bson:"coordinates"`
+}
+
+// ValidCoordinates tells whether a longitude and a latitude
+// are in their respective valid ranges.
+func ValidCoordinates(longitude, latitude float64) bool {
+	return longitude >= -180 && longitude <= 180 && latitude >= -90 && latitude <= 90
+}
+
+// position validates a raw GeoJSON position: exactly a longitude
+// and a latitude, in their valid ranges.
+func position(coordinates []float64) ([2]float64, error) {
+	if len(coordinates) != 2 {
+		return [2]float64{}, errors.New("the positions must have exactly a longitude and a latitude")
+	}
+	if !ValidCoordinates(coordinates[0], coordinates[1]) {
+		return [2]float64{}, errors.New("the coordinates are out of range")
+	}
+	return [2]float64{coordinates[0], coordinates[1]}, nil
+}
+
+// GeoPoint is a position which is stored and rendered as a
+// GeoJSON point, so it can be indexed by 2dsphere indexes.
+type GeoPoint struct {
+	Longitude float64
+	Latitude  float64
+}
+
+// raw returns the GeoJSON form of the point.
+func (point GeoPoint) raw() geoJSON[[]float64] {
+	return geoJSON[[]float64]{Type: "Point", Coordinates: []float64{point.Longitude, point.Latitude}}
+}
+
+// fromRaw sets the point from its GeoJSON form, validating it.
+func (point *GeoPoint) fromRaw(raw geoJSON[[]float64]) error {
+	if raw.Type != "Point" {
+		return errors.New("the GeoJSON object is not a Point")
+	}
+	coordinates, err := position(raw.Coordinates)
+	if err != nil {
+		return err
+	}
+	point.Longitude, point.Latitude = coordinates[0], coordinates[1]
+	return nil
+}
+
+// MarshalJSON renders the point as GeoJSON.
+func (point GeoPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(point.raw())
+}
+
+// UnmarshalJSON parses the point from GeoJSON.
+func (point *GeoPoint) UnmarshalJSON(b []byte) error {
+	var raw geoJSON[[]float64]
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	return point.fromRaw(raw)
+}
+
+// MarshalBSON stores the point as a GeoJSON document.
+func (point GeoPoint) MarshalBSON() ([]byte, error) {
+	return bson.Marshal(point.raw())
+}
+
+// UnmarshalBSON loads the point from a GeoJSON document.
+func (point *GeoPoint) UnmarshalBSON(b []byte) error {
+	var raw geoJSON[[]float64]
+	if err := bson.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	return point.fromRaw(raw)
+}
+
+// GeoPolygon is an area which is stored and rendered as a GeoJSON
+// polygon: a list of linear rings, where the first one is the outer
+// boundary and the other ones (if any) are holes. Each ring is a list
+// of (longitude, latitude) positions, being the last one the same as
+// the first one.
+type GeoPolygon struct {
+	Rings [][][2]float64
+}
+
+// NewGeoBox creates a rectangular polygon out of its bottom-left
+// and top-right corners.
+func NewGeoBox(bottomLeft, topRight GeoPoint) GeoPolygon {
+	return GeoPolygon{Rings: [][][2]float64{{
+		{bottomLeft.Longitude, bottomLeft.Latitude},
+		{topRight.Longitude, bottomLeft.Latitude},
+		{topRight.Longitude, topRight.Latitude},
+		{bottomLeft.Longitude, topRight.Latitude},
+		{bottomLeft.Longitude, bottomLeft.Latitude},
+	}}}
+}
+
+// raw returns the GeoJSON form of the polygon.
+func (polygon GeoPolygon) raw() geoJSON[[][][2]float64] {
+	return geoJSON[[][][2]float64]{Type: "Polygon", Coordinates: polygon.Rings}
+}
+
+// fromRaw sets the polygon from its GeoJSON form, validating it.
+func (polygon *GeoPolygon) fromRaw(raw geoJSON[[][][]float64]) error {
+	if raw.Type != "Polygon" {
+		return errors.New("the GeoJSON object is not a Polygon")
+	}
+	if len(raw.Coordinates) == 0 {
+		return errors.New("the polygon has no rings")
+	}
+	rings := make([][][2]float64, len(raw.Coordinates))
+	for index, ring := range raw.Coordinates {
+		if len(ring) < 4 {
+			return errors.New("the polygon rings must have at least 4 positions")
+		}
+		rings[index] = make([][2]float64, len(ring))
+		for positionIndex, coordinates := range ring {
+			var err error
+			if rings[index][positionIndex], err = position(coordinates); err != nil {
+				return err
+			}
+		}
+		if rings[index][0] != rings[index][len(ring)-1] {
+			return errors.New("the polygon rings must be closed")
+		}
+	}
+	polygon.Rings = rings
+	return nil
+}
+
+// MarshalJSON renders the polygon as GeoJSON.
+func (polygon GeoPolygon) MarshalJSON() ([]byte, error) {
+	return json.Marshal(polygon.raw())
+}
+
+// UnmarshalJSON parses the polygon from GeoJSON.
+func (polygon *GeoPolygon) UnmarshalJSON(b []byte) error {
+	var raw geoJSON[[][][]float64]
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	return polygon.fromRaw(raw)
+}
+
+// MarshalBSON stores the polygon as a GeoJSON document.
+func (polygon GeoPolygon) MarshalBSON() ([]byte, error) {
+	return bson.Marshal(polygon.raw())
+}
+
+// UnmarshalBSON loads the polygon from a GeoJSON document.
+func (polygon *GeoPolygon) UnmarshalBSON(b []byte) error {
+	var raw geoJSON[[][][]float64]
+	if err := bson.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	return polygon.fromRaw(raw)
+}
@@ -0,0 +1,41 @@
+package responses
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+// Error is a structured error which aborts a request (e.g. when
+// returned by a resource hook). It is rendered as a message with
+// the given status and code and, optionally, some details.
+type Error struct {
+	Status  int
+	Code    string
+	Details any
+}
+
+// Error returns the code of the error.
+func (err *Error) Error() string {
+	return err.Code
+}
+
+// Element builds the message of the error (e.g. for a
+// single element of a bulk operation).
+func (err *Error) Element() echo.Map {
+	body := echo.Map{"code": err.Code}
+	if err.Details != nil {
+		body["details"] = err.Details
+	}
+	return body
+}
+
+// Render dumps the error as a message response in the
+// gin context.
+func (err *Error) Render(c echo.Context) error {
+	return c.JSON(err.Status, err.Element())
+}
+
+// Abort builds a structured error with the given status, code
+// and (optional) details.
+func Abort(status int, code string, details any) *Error {
+	return &Error{Status: status, Code: code, Details: details}
+}
@@ -109,6 +109,13 @@ func UnexpectedFormat(c echo.Context) error {
 // response (400) in the gin context, with the errors
 // that must flow to the user.
 func InvalidFormat(c echo.Context, errors validator.ValidationErrors) error {
+	return c.JSON(http.StatusBadRequest, InvalidFormatElement(errors))
+}
+
+// InvalidFormatElement builds the "invalid format" message
+// for a single element, with the errors that must flow to
+// the user.
+func InvalidFormatElement(errors validator.ValidationErrors) echo.Map {
 	errorMessages := make(map[string][]string)
 	for _, value := range errors {
 		namespace := strings.SplitN(value.Namespace(), ".", 2)[1]
@@ -117,9 +124,193 @@ func InvalidFormat(c echo.Context, errors validator.ValidationErrors) error {
 		}
 		errorMessages[namespace] = append(errorMessages[namespace], value.Tag())
 	}
-	return c.JSON(http.StatusBadRequest, echo.Map{
+	return echo.Map{
 		"code":   "schema:invalid",
 		"errors": errorMessages,
+	}
+}
+
+// UnexpectedFormatElement builds the "unexpected format"
+// message for a single element.
+func UnexpectedFormatElement() echo.Map {
+	return echo.Map{
+		"code": "format:unexpected",
+	}
+}
+
+// DuplicateKeyElement builds the "duplicate key" message
+// for a single element.
+func DuplicateKeyElement() echo.Map {
+	return echo.Map{
+		"code": "duplicate-key",
+	}
+}
+
+// InternalErrorElement builds the "internal error"
+// message for a single element.
+func InternalErrorElement() echo.Map {
+	return echo.Map{
+		"code": "internal-error",
+	}
+}
+
+// NotAttemptedElement builds the "not attempted" message
+// for a single element, which was not written because a
+// prior element failed.
+func NotAttemptedElement() echo.Map {
+	return echo.Map{
+		"code": "bulk:not-attempted",
+	}
+}
+
+// BulkInvalid dumps an "invalid bulk" message response
+// (400) in the gin context, with the errors of each of
+// the invalid elements (by their index or id).
+func BulkInvalid(c echo.Context, errors map[string]echo.Map) error {
+	return c.JSON(http.StatusBadRequest, echo.Map{
+		"code":   "bulk:invalid",
+		"errors": errors,
+	})
+}
+
+// BulkTooLarge dumps a "bulk too large" message response
+// (413) in the gin context, with the maximum allowed size
+// (i.e. the maximum number of created or affected elements).
+func BulkTooLarge(c echo.Context, max int64) error {
+	return c.JSON(http.StatusRequestEntityTooLarge, echo.Map{
+		"code": "bulk:too-large",
+		"max":  max,
+	})
+}
+
+// BulkCreated dumps the result of a bulk creation: a 201
+// message with the created ids when all the elements were
+// created, or a 207 message with the created ids (null for
+// the elements not created) and the errors of each of the
+// failed elements (by their index) otherwise. When the write
+// concern was not satisfied, the elements were still created
+// and a "write-concern" warning is added, so clients do not
+// retry (and duplicate) them.
+func BulkCreated(c echo.Context, ids []any, errors map[string]echo.Map, unconcerned bool) error {
+	status := http.StatusCreated
+	result := echo.Map{"ids": ids}
+	if len(errors) != 0 {
+		status = http.StatusMultiStatus
+		result["code"] = "bulk:partial"
+		result["errors"] = errors
+	}
+	if unconcerned {
+		result["warning"] = "write-concern"
+	}
+	return c.JSON(status, result)
+}
+
+// BulkUpdated dumps the result of a bulk update: a 200
+// message with the matched and modified counts when all
+// the elements were updated, or a 207 message with the
+// counts and the errors of each of the failed elements
+// (by their id) otherwise.
+func BulkUpdated(c echo.Context, matched, modified int, errors map[string]echo.Map) error {
+	if len(errors) == 0 {
+		return c.JSON(http.StatusOK, echo.Map{
+			"matched":  matched,
+			"modified": modified,
+		})
+	}
+	return c.JSON(http.StatusMultiStatus, echo.Map{
+		"code":     "bulk:partial",
+		"matched":  matched,
+		"modified": modified,
+		"errors":   errors,
+	})
+}
+
+// InvalidQuery dumps an "invalid query" message
+// response (400) in the gin context, with the errors
+// found in the query string parameters.
+func InvalidQuery(c echo.Context, errors map[string][]string) error {
+	return c.JSON(http.StatusBadRequest, echo.Map{
+		"code":   "query:invalid",
+		"errors": errors,
+	})
+}
+
+// InvalidPatch dumps an "invalid patch" message
+// response (400) in the gin context, with the errors
+// found in the patch operations.
+func InvalidPatch(c echo.Context, errors map[string][]string) error {
+	return c.JSON(http.StatusBadRequest, InvalidPatchElement(errors))
+}
+
+// InvalidPatchElement builds the "invalid patch" message
+// for a single element, with the errors found in the
+// patch operations.
+func InvalidPatchElement(errors map[string][]string) echo.Map {
+	return echo.Map{
+		"code":   "patch:invalid",
+		"errors": errors,
+	}
+}
+
+// ConcurrentModification dumps a simple "concurrent
+// modification" message response (409) in the gin
+// context, when an element changed while it was being
+// updated.
+func ConcurrentModification(c echo.Context) error {
+	return c.JSON(http.StatusConflict, echo.Map{
+		"code": "concurrent-modification",
+	})
+}
+
+// ConcurrentModificationElement builds the "concurrent
+// modification" message for a single element.
+func ConcurrentModificationElement() echo.Map {
+	return echo.Map{
+		"code": "concurrent-modification",
+	}
+}
+
+// PreconditionFailed dumps a simple "precondition failed"
+// message response (412) in the gin context, when an element
+// does not have any of the versions told in If-Match.
+func PreconditionFailed(c echo.Context) error {
+	return c.JSON(http.StatusPreconditionFailed, echo.Map{
+		"code": "precondition:failed",
+	})
+}
+
+// PreconditionRequired dumps a simple "precondition required"
+// message response (428) in the gin context, when the If-Match
+// header is mandatory but it was not told.
+func PreconditionRequired(c echo.Context) error {
+	return c.JSON(http.StatusPreconditionRequired, echo.Map{
+		"code": "precondition:required",
+	})
+}
+
+// InvalidIdempotencyKey dumps a simple "invalid idempotency
+// key" message response (400) in the gin context.
+func InvalidIdempotencyKey(c echo.Context) error {
+	return c.JSON(http.StatusBadRequest, echo.Map{
+		"code": "idempotency:invalid-key",
+	})
+}
+
+// IdempotencyConflict dumps a simple "idempotency conflict"
+// message response (409) in the gin context, when an
+// idempotency key is reused for a different request.
+func IdempotencyConflict(c echo.Context) error {
+	return c.JSON(http.StatusConflict, echo.Map{
+		"code": "idempotency:conflict",
+	})
+}
+
+// IdempotencyInProgress dumps a simple "idempotency in
+// progress" message response (409) in the gin context,
+// when a request is retried while it is being processed.
+func IdempotencyInProgress(c echo.Context) error {
+	return c.JSON(http.StatusConflict, echo.Map{
+		"code": "idempotency:in-progress",
 	})
 }
 
@@ -57,18 +57,20 @@ func requiredIifValidator(fl validator.FieldLevel) bool {
 	if !field.IsValid() {
 		panic("require_iif requires a valid int-like field to be specified")
 	} else if field.Kind() == reflect.Int || field.Kind() == reflect.Int64 {
-		paramValue, err := strconv.Atoi(paramValueStr)
-		if err != nil || paramValue < 0 {
+		value, err := strconv.Atoi(paramValueStr)
+		if err != nil || value < 0 {
 			panic("require_iif requires the comparison value to be a valid non-negative integer number")
 		}
+		paramValue = value
 		actualFieldValue = int(field.Int())
 	} else if field.Kind() == reflect.Uint || field.Kind() == reflect.Uint64 {
-		paramValue, err := strconv.ParseUint(paramValueStr, 10, 64)
+		value, err := strconv.ParseUint(paramValueStr, 10, 64)
 		if err != nil {
 			panic("require_iif requires the comparison value to be a valid non-negative integer number")
-		} else if paramValue > (^uint64(0) >> 1) {
+		} else if value > (^uint64(0) >> 1) {
 			return true
 		}
+		paramValue = int(value)
 		actualFieldValue = int(field.Uint())
 	} else {
 		panic("require_iif requires a valid int-like field to be specified")
@@ -25,8 +25,9 @@ func LaunchServer() {
 			},
 		},
 		Resources: map[string]dsl.Resource{
-			"universe": universe.UniverseResource,
-			"payments": payments.PaymentsResource,
+			"universe":       universe.UniverseResource,
+			"payments":       payments.PaymentsResource,
+			"payment-totals": payments.PaymentTotalsResource,
 		},
 	}
 
@@ -17,10 +17,11 @@ import (
 
 // Payment is a payment record.
 type Payment struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
-	FromAddr string             `validate:"required" bson:"from" json:"from"`
-	Amount   int                `validate:"required,gt=0" bson:"amount" json:"amount"`
-	When     formats.DateTime   `validate:"required" bson:"when" json:"when"`
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	FromAddr  string             `validate:"required" bson:"from" json:"from"`
+	Amount    int                `validate:"required,gt=0" bson:"amount" json:"amount"`
+	When      formats.DateTime   `validate:"required" bson:"when" json:"when"`
+	dsl.Audit `bson:",inline"`
 }
 
 var (
@@ -31,9 +32,35 @@ var (
 			Collection: "payments",
 		},
 		SoftDelete: true,
+		PurgeAfter: 30 * 24 * time.Hour,
 		ModelType:  dsl.ModelType[Payment],
+		Verbs: []dsl.ResourceVerb{
+			dsl.ListVerb, dsl.CreateVerb, dsl.ReadVerb, dsl.UpdateVerb, dsl.ReplaceVerb, dsl.DeleteVerb,
+			dsl.CountVerb, dsl.DistinctVerb, dsl.BulkCreateVerb, dsl.BulkDeleteVerb,
+		},
 		// Projection: bson.M{"foo": "bar"},
-		ItemProjection: bson.M{"from": 1, "amount": 1, "when": 1},
+		ItemProjection: bson.M{"from": 1, "amount": 1, "when": 1, "created_at": 1, "updated_at": 1},
+		Filterable: dsl.Filterable{
+			"from":   {dsl.FilterEq, dsl.FilterIn},
+			"amount": {dsl.FilterGt, dsl.FilterGte, dsl.FilterLt, dsl.FilterLte},
+			"when":   {dsl.FilterGt, dsl.FilterLt},
+		},
+		Sortable:  []string{"amount", "when"},
+		ListCount: true,
+		Versioned: true,
+		Audited:   true,
+		History:   true,
+		Distinct:  []string{"from"},
+		PatchPolicy: &dsl.PatchPolicy{
+			Operators: []dsl.PatchOperator{dsl.PatchSet, dsl.PatchInc},
+			Paths:     []string{"amount", "when"},
+		},
+		Stats: &dsl.Stats{
+			GroupBy: []string{"from"},
+			Accumulators: map[string][]dsl.StatsAccumulator{
+				"amount": {dsl.StatsSum, dsl.StatsAvg, dsl.StatsMin, dsl.StatsMax},
+			},
+		},
 		Methods: map[string]dsl.ResourceMethod{
 			"get-from": {
 				Type: dsl.View,
@@ -0,0 +1,39 @@
+package payments
+
+import (
+	"github.com/AlephVault/golang-standard-http-mongodb-storage/core/dsl"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PaymentTotal is the total amount paid from a given address.
+type PaymentTotal struct {
+	FromAddr string `bson:"_id" json:"from"`
+	Total    int    `bson:"total" json:"total"`
+	Count    int    `bson:"count" json:"count"`
+}
+
+// PaymentTotalsParameters stands for the query string parameters
+// of the payment totals view.
+type PaymentTotalsParameters struct {
+	MinAmount int `query:"min_amount" validate:"gte=0"`
+}
+
+var (
+	PaymentTotalsResource = dsl.Resource{
+		Type: dsl.ViewResource,
+		TableRef: dsl.TableRef{
+			Db:         "mydb",
+			Collection: "payments",
+		},
+		SoftDelete: true,
+		ModelType:  dsl.ModelType[PaymentTotal],
+		Parameters: dsl.ModelType[PaymentTotalsParameters],
+		Pipeline: bson.A{
+			bson.M{"$match": bson.M{"amount": bson.M{"$gte": dsl.Param("min_amount")}}},
+			bson.M{"$group": bson.M{"_id": "$from", "total": bson.M{"$sum": "$amount"}, "count": bson.M{"$sum": 1}}},
+		},
+		Sort:      bson.D{{Key: "total", Value: -1}},
+		Sortable:  []string{"total", "count"},
+		ListCount: true,
+	}
+)
@@ -10,6 +10,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"time"
 )
 
 // UniverseVersion stands for the version of the game's universe / layout.
@@ -76,6 +77,7 @@ var (
 		},
 		SoftDelete: true,
 		ModelType:  dsl.ModelType[Universe],
+		CacheTTL:   time.Minute,
 		// Projection: bson.M{"foo": "bar"},
 		Projection: bson.M{"caption": 1, "motd": 1},
 		Methods: map[string]dsl.ResourceMethod{